@@ -0,0 +1,514 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/chainreactors/crtm/pkg"
+	"github.com/chainreactors/crtm/pkg/bundle"
+	"github.com/chainreactors/crtm/pkg/cache"
+	"github.com/chainreactors/crtm/pkg/lockfile"
+	"github.com/chainreactors/crtm/pkg/manifest"
+	"github.com/chainreactors/crtm/pkg/path"
+	"github.com/chainreactors/crtm/pkg/plan"
+	"github.com/chainreactors/crtm/pkg/store"
+	"github.com/chainreactors/crtm/pkg/types"
+	"github.com/chainreactors/crtm/pkg/utils"
+	"github.com/projectdiscovery/gologger"
+	fileutil "github.com/projectdiscovery/utils/file"
+	stringsutil "github.com/projectdiscovery/utils/strings"
+)
+
+// command is a positional sub command of crtm, commands run instead of the install/update/remove flags
+type command struct {
+	name        string
+	usage       string
+	description string
+	run         func(r *Runner, args []string) error
+}
+
+var commands = []command{
+	{
+		name:        "use",
+		usage:       "use <tool>[@version]...",
+		description: "switch the active version of installed tools, without version the installed versions are listed",
+		run:         (*Runner).use,
+	},
+	{
+		name:        "rollback",
+		usage:       "rollback <tool>...",
+		description: "restore the previously active version of tools",
+		run:         (*Runner).rollback,
+	},
+	{
+		name:        "lock",
+		usage:       "lock [tool]...",
+		description: "write the releases of installed tools, or given tools, to " + lockfile.DefaultName,
+		run:         (*Runner).lock,
+	},
+	{
+		name:        "sync",
+		usage:       "sync [manifest]",
+		description: "install, update or downgrade tools to the versions of a manifest (default " + manifest.DefaultName + ")",
+		run:         (*Runner).sync,
+	},
+	{
+		name:        "verify",
+		usage:       "verify [tool]...",
+		description: "re-hash installed tools and report modified, missing or foreign files",
+		run:         (*Runner).verify,
+	},
+	{
+		name:        "doctor",
+		usage:       "doctor",
+		description: "diagnose the environment and suggest fixes",
+		run:         (*Runner).doctor,
+	},
+	{
+		name:        "cache",
+		usage:       "cache ls|prune [max-size]",
+		description: "list the download cache or prune it to max-size (e.g. 500mb, default 0)",
+		run:         (*Runner).cache,
+	},
+	{
+		name:        "bundle",
+		usage:       "bundle create|install [file]",
+		description: "package releases for air-gapped networks (-tools, -platforms, -o) or install from a bundle",
+		run:         (*Runner).bundle,
+	},
+}
+
+func getCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// commandsHelp returns the help text of sub commands appended to the flags usage
+func commandsHelp() string {
+	builder := &strings.Builder{}
+	builder.WriteString("COMMANDS:\n")
+	for _, cmd := range commands {
+		builder.WriteString(fmt.Sprintf("   %-30s %s\n", cmd.usage, cmd.description))
+	}
+	return builder.String()
+}
+
+// runCommand runs the sub command given on the command line
+func (r *Runner) runCommand() error {
+	cmd, ok := getCommand(r.options.Command)
+	if !ok {
+		return fmt.Errorf("unknown command %s", r.options.Command)
+	}
+	return cmd.run(r, r.options.Args)
+}
+
+// use switches the active version of tools given as name@version
+func (r *Runner) use(args []string) error {
+	if len(args) == 0 {
+		return errors.New("no tool given, usage: crtm use <tool>@<version>")
+	}
+	if !path.IsSubPath(homeDir, r.options.Path) {
+		return fmt.Errorf("binary path %s is outside home folder", r.options.Path)
+	}
+	for _, arg := range args {
+		toolName, toolVersion := utils.ParseToolVersion(arg)
+		if entry, ok := utils.Registry.Get(toolName); ok {
+			toolName = entry.Name
+		}
+		versions, err := store.Versions(toolName)
+		if err != nil {
+			return err
+		}
+		if toolVersion == "" {
+			active, _ := store.Active(r.options.Path, toolName)
+			for i, v := range versions {
+				if v == active {
+					versions[i] = au.BrightGreen(v + " (active)").String()
+				}
+			}
+			if len(versions) == 0 {
+				gologger.Info().Msgf("%s: no version installed", toolName)
+			} else {
+				gologger.Info().Msgf("%s: %s", toolName, strings.Join(versions, ", "))
+			}
+			continue
+		}
+		if err := store.Activate(r.options.Path, toolName, toolVersion); err != nil {
+			if errors.Is(err, store.ErrVersionNotInstalled) {
+				return fmt.Errorf("%s %s is not installed, install it with -install %s@%s", toolName, toolVersion, toolName, toolVersion)
+			}
+			return err
+		}
+		gologger.Info().Msgf("using %s %s", toolName, toolVersion)
+	}
+	return nil
+}
+
+// rollback restores the previous generation of given tools
+func (r *Runner) rollback(args []string) error {
+	if len(args) == 0 {
+		return errors.New("no tool given, usage: crtm rollback <tool>")
+	}
+	if !path.IsSubPath(homeDir, r.options.Path) {
+		return fmt.Errorf("binary path %s is outside home folder", r.options.Path)
+	}
+	for _, toolName := range args {
+		entry, ok := utils.Registry.Get(toolName)
+		if !ok {
+			return fmt.Errorf("%s not found in the list", toolName)
+		}
+		if err := pkg.Rollback(r.options.Path, entry.Tool()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lock writes the installed release of tools with the checksums of their assets to the lockfile,
+// tools given as name@version are locked to that release even if it isn't installed
+func (r *Runner) lock(args []string) error {
+	var tools []types.Tool
+	if len(args) == 0 {
+		for _, entry := range utils.Registry.Tools {
+			tool := entry.Tool()
+			if installedVersion, err := utils.GetInstalledVersion(tool, r.options.Path); err == nil {
+				args = append(args, tool.Name+"@"+installedVersion)
+			}
+		}
+		if len(args) == 0 {
+			return errors.New("no tool installed, usage: crtm lock <tool>[@version]")
+		}
+	}
+	for _, arg := range args {
+		toolName, toolVersion := utils.ParseToolVersion(arg)
+		var tool types.Tool
+		var err error
+		if toolVersion == "" {
+			tool, err = utils.FetchTool(toolName)
+		} else {
+			tool, err = utils.FetchToolVersion(toolName, toolVersion)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", arg, err)
+		}
+		tools = append(tools, tool)
+	}
+	lock := &lockfile.Lockfile{}
+	for _, tool := range tools {
+		entry, err := pkg.Lock(tool)
+		if err != nil {
+			return err
+		}
+		lock.Tools = append(lock.Tools, entry)
+		gologger.Info().Msgf("locked %s %s (%d platforms)", entry.Name, entry.Version, len(entry.Assets))
+	}
+	if err := lock.Write(lockfile.DefaultName); err != nil {
+		return err
+	}
+	gologger.Info().Msgf("wrote %s", lockfile.DefaultName)
+	return nil
+}
+
+// installFrozen installs the releases recorded in the lockfile, the first failure aborts the install
+func (r *Runner) installFrozen() error {
+	if !path.IsSubPath(homeDir, r.options.Path) {
+		return fmt.Errorf("binary path %s is outside home folder", r.options.Path)
+	}
+	lock, err := lockfile.Read(r.options.Frozen)
+	if err != nil {
+		return err
+	}
+	for _, entry := range lock.Tools {
+		tool := types.Tool{Name: entry.Name, InstallType: types.Binary}
+		if registryEntry, ok := utils.Registry.Get(entry.Name); ok {
+			tool = registryEntry.Tool()
+		}
+		if entry.Repo != "" {
+			// the lockfile is authoritative on where the release is downloaded from
+			tool.Org, tool.Repo, tool.Provider, tool.ProviderURL = entry.Org, entry.Repo, entry.Provider, entry.URL
+		}
+		release, err := utils.FetchRelease(tool, entry.Version)
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", entry.Name, entry.Version, err)
+		}
+		utils.SetRelease(&tool, release)
+		if err := pkg.InstallLocked(r.options.Path, tool, entry); err != nil {
+			return err
+		}
+		printRequirementInfo(gologger.DefaultLogger, tool)
+	}
+	return nil
+}
+
+// sync prints then applies the plan bringing installed tools to the manifest
+func (r *Runner) sync(args []string) error {
+	manifestPath := manifest.DefaultName
+	if len(args) > 0 {
+		manifestPath = args[0]
+	}
+	m, err := manifest.Read(manifestPath)
+	if err != nil {
+		return err
+	}
+	if !path.IsSubPath(homeDir, r.options.Path) {
+		return fmt.Errorf("binary path %s is outside home folder", r.options.Path)
+	}
+	var wanted []types.Tool
+	for _, entry := range m.Tools {
+		var tool types.Tool
+		if entry.Version == "" {
+			tool, err = utils.FetchTool(entry.Name)
+		} else {
+			tool, err = utils.FetchToolVersion(entry.Name, entry.Version)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Name, err)
+		}
+		wanted = append(wanted, tool)
+	}
+	var prune []types.Tool
+	if m.Prune {
+		for _, entry := range utils.Registry.Tools {
+			prune = append(prune, entry.Tool())
+		}
+	}
+	installed := map[string]string{}
+	for _, tool := range append(wanted, prune...) {
+		if installedVersion, err := utils.GetInstalledVersion(tool, r.options.Path); err == nil {
+			installed[tool.Name] = installedVersion
+		}
+	}
+
+	p := plan.Sync(wanted, installed, prune)
+	if !p.Changes() {
+		gologger.Info().Msgf("%s is in sync", manifestPath)
+		return nil
+	}
+	gologger.Info().Msgf("plan:")
+	for _, step := range p {
+		gologger.Print().Msgf("  %s", step)
+	}
+	if _, failed := r.apply(p); failed > 0 {
+		return fmt.Errorf("%d steps failed, %s is not in sync", failed, manifestPath)
+	}
+	return nil
+}
+
+// verify checks the installed versions of given tools, or every installed tool, and fails if any file doesn't match
+func (r *Runner) verify(args []string) error {
+	var tools []types.Tool
+	for _, toolName := range args {
+		entry, ok := utils.Registry.Get(toolName)
+		if !ok {
+			return fmt.Errorf("%s not found in the list", toolName)
+		}
+		tools = append(tools, entry.Tool())
+	}
+	if len(args) == 0 {
+		for _, entry := range utils.Registry.Tools {
+			if versions, err := store.Versions(entry.Name); err == nil && len(versions) > 0 {
+				tools = append(tools, entry.Tool())
+			} else if _, exists := path.GetExecutablePath(r.options.Path, entry.Name); exists {
+				tools = append(tools, entry.Tool())
+			}
+		}
+	}
+	var failed int
+	for _, tool := range tools {
+		result, err := pkg.Verify(r.options.Path, tool)
+		if err != nil {
+			return fmt.Errorf("%s: %w", tool.Name, err)
+		}
+		if len(result.Versions) == 0 && len(result.Issues) == 0 {
+			gologger.Info().Msgf("%s: not installed", tool.Name)
+			continue
+		}
+		if len(result.Issues) == 0 {
+			msg := au.BrightGreen("ok").String()
+			if len(result.Unchecked) > 0 {
+				msg += fmt.Sprintf(" (no release checksums for %s)", strings.Join(result.Unchecked, ", "))
+			}
+			gologger.Info().Msgf("%s %s: %s", tool.Name, strings.Join(result.Versions, ", "), msg)
+			continue
+		}
+		failed++
+		for _, issue := range result.Issues {
+			gologger.Error().Msgf("%s %s", tool.Name, issue)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("verification failed for %d tools", failed)
+	}
+	return nil
+}
+
+// cache lists or prunes the download cache
+func (r *Runner) cache(args []string) error {
+	if len(args) == 0 {
+		return errors.New("no cache command given, usage: crtm cache ls|prune [max-size]")
+	}
+	switch args[0] {
+	case "ls", "list":
+		entries, err := cache.List()
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			gologger.Print().Msgf("%s %s %s %s %s (used %s)", entry.Repo, entry.Version, entry.Asset, formatSize(entry.Size), entry.SHA256[:12], entry.UsedAt.Format("2006-01-02"))
+		}
+		gologger.Info().Msgf("%d assets, %s in %s", len(entries), formatSize(cache.Size(entries)), cache.Root)
+		return nil
+	case "prune":
+		var maxSize int64
+		if len(args) > 1 {
+			size, err := fileutil.FileSizeToByteLen(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid cache size %s: %w", args[1], err)
+			}
+			maxSize = int64(size)
+		}
+		removed, err := cache.Prune(maxSize)
+		if err != nil {
+			return err
+		}
+		for _, entry := range removed {
+			gologger.Verbose().Msgf("removed %s %s %s", entry.Repo, entry.Version, entry.Asset)
+		}
+		gologger.Info().Msgf("removed %d assets, %s freed", len(removed), formatSize(cache.Size(removed)))
+		return nil
+	default:
+		return fmt.Errorf("unknown cache command %s, usage: crtm cache ls|prune [max-size]", args[0])
+	}
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// bundle creates a bundle of the releases of -tools for -platforms, or installs the tools of a bundle
+func (r *Runner) bundle(args []string) error {
+	if len(args) == 0 {
+		return errors.New("no bundle command given, usage: crtm bundle create|install [bundle] [tool]...")
+	}
+	switch args[0] {
+	case "create":
+		return r.createBundle()
+	case "install":
+		if len(args) < 2 {
+			return errors.New("no bundle given, usage: crtm bundle install <bundle> [tool]...")
+		}
+		return r.installBundle(args[1], args[2:])
+	default:
+		return fmt.Errorf("unknown bundle command %s, usage: crtm bundle create|install [bundle] [tool]...", args[0])
+	}
+}
+
+func (r *Runner) createBundle() error {
+	platforms := r.options.Platforms
+	if len(platforms) == 0 {
+		platforms = []string{lockfile.Platform(runtime.GOOS, runtime.GOARCH)}
+	}
+	for _, platform := range platforms {
+		if goos, goarch, ok := strings.Cut(platform, "/"); !ok || goos == "" || goarch == "" {
+			return fmt.Errorf("invalid platform %s, expected os/arch", platform)
+		}
+	}
+	toolNames := r.options.Tools
+	if len(toolNames) == 0 {
+		for _, entry := range utils.Registry.Tools {
+			toolNames = append(toolNames, entry.Name)
+		}
+	}
+
+	w, err := bundle.Create(r.options.Output)
+	if err != nil {
+		return err
+	}
+	for _, toolArg := range toolNames {
+		toolName, toolVersion := utils.ParseToolVersion(toolArg)
+		entry, ok := utils.Registry.Get(toolName)
+		if !ok {
+			w.Abort()
+			return fmt.Errorf("%s not found in the list", toolName)
+		}
+		var tool types.Tool
+		if toolVersion == "" {
+			tool, err = utils.FetchTool(entry.Name)
+		} else {
+			tool, err = utils.FetchToolVersion(entry.Name, toolVersion)
+		}
+		if err == nil {
+			err = pkg.AddToBundle(w, entry, tool, platforms)
+		}
+		if err != nil {
+			w.Abort()
+			return fmt.Errorf("%s: %w", toolArg, err)
+		}
+		gologger.Info().Msgf("bundled %s %s", tool.Name, tool.Version)
+	}
+	if err := w.Close(); err != nil {
+		w.Abort()
+		return err
+	}
+	gologger.Info().Msgf("wrote %s (%s)", r.options.Output, strings.Join(platforms, ", "))
+	return nil
+}
+// installBundle installs the tools of a bundle without network access, with no tool names every tool in the bundle is installed
+// installBundle installs the tools of a bundle without network access, all tools are installed without names
+func (r *Runner) installBundle(bundlePath string, toolNames []string) error {
+	if !path.IsSubPath(homeDir, r.options.Path) {
+		return fmt.Errorf("binary path %s is outside home folder", r.options.Path)
+	}
+	dir, err := os.MkdirTemp("", "crtm-bundle-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	manifest, snapshot, err := bundle.Extract(bundlePath, dir)
+	if err != nil {
+		return err
+	}
+	var bundledNames []string
+	for _, bundled := range manifest.Tools {
+		bundledNames = append(bundledNames, bundled.Name)
+	}
+	for _, toolName := range toolNames {
+		if !stringsutil.EqualFoldAny(toolName, bundledNames...) {
+			return fmt.Errorf("%s: not found in %s", toolName, bundlePath)
+		}
+	}
+	for _, bundled := range manifest.Tools {
+		if len(toolNames) > 0 && !stringsutil.EqualFoldAny(bundled.Name, toolNames...) {
+			continue
+		}
+		entry, ok := snapshot.Get(bundled.Name)
+		if !ok {
+			return fmt.Errorf("%s: missing from the bundle registry", bundled.Name)
+		}
+		// keys pinned in the local registry are required whatever the bundle registry says
+		if local, ok := utils.Registry.Get(bundled.Name); ok && len(local.PublicKeys) > 0 {
+			entry.PublicKeys = local.PublicKeys
+		}
+		if err := pkg.InstallFromBundle(r.options.Path, dir, entry, bundled); err != nil {
+			return err
+		}
+		printRequirementInfo(gologger.DefaultLogger, entry.Tool())
+	}
+	return nil
+}
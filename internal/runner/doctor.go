@@ -0,0 +1,213 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chainreactors/crtm/pkg/path"
+	"github.com/chainreactors/crtm/pkg/utils"
+	"github.com/google/go-github/github"
+	"github.com/projectdiscovery/gologger"
+)
+
+// cacheMaxAge is the age after which the cached tool list is reported as stale
+var cacheMaxAge = 24 * time.Hour
+
+type checkStatus int
+
+const (
+	pass checkStatus = iota
+	warn
+	fail
+)
+
+func (s checkStatus) String() string {
+	switch s {
+	case pass:
+		return au.BrightGreen("pass").String()
+	case warn:
+		return au.Yellow("warn").String()
+	default:
+		return au.Red("fail").String()
+	}
+}
+
+// check is the result of a single doctor diagnostic, fix is the suggested remediation
+type check struct {
+	name    string
+	status  checkStatus
+	message string
+	fix     string
+}
+
+// doctor runs the environment diagnostics and fails if any check fails
+func (r *Runner) doctor(_ []string) error {
+	var checks []check
+	checks = append(checks, r.checkBinaryPath(), r.checkPath(), checkRCFile())
+	checks = append(checks, checkGithub()...)
+	checks = append(checks, checkCache())
+	checks = append(checks, r.checkRequirements()...)
+
+	var failed int
+	for _, c := range checks {
+		gologger.Print().Msgf("[%s] %s: %s", c.status, c.name, c.message)
+		if c.status != pass && c.fix != "" {
+			gologger.Print().Msgf("       fix: %s", c.fix)
+		}
+		if c.status == fail {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d checks failed", failed)
+	}
+	return nil
+}
+
+func (r *Runner) checkBinaryPath() check {
+	c := check{name: "binary path"}
+	if !path.IsSubPath(homeDir, r.options.Path) {
+		c.status, c.message = fail, fmt.Sprintf("%s is outside home folder %s, install/update/remove skip every tool", r.options.Path, homeDir)
+		c.fix = fmt.Sprintf("use a binary path under the home folder, e.g. -bp %s", defaultPath)
+		return c
+	}
+	c.message = r.options.Path
+	return c
+}
+
+func (r *Runner) checkPath() check {
+	c := check{name: "PATH"}
+	if path.IsSet(r.options.Path) {
+		c.message = fmt.Sprintf("%s is in $PATH", r.options.Path)
+		return c
+	}
+	c.status, c.message = warn, fmt.Sprintf("%s is not in $PATH of the current shell", r.options.Path)
+	c.fix = "run crtm -install-path then reload the shell"
+	if rcFile, err := path.RCFile(); err == nil && rcFile != "" {
+		if data, err := os.ReadFile(rcFile); err == nil && strings.Contains(string(data), r.options.Path) {
+			c.message = fmt.Sprintf("%s is exported in %s but not sourced", r.options.Path, rcFile)
+			c.fix = fmt.Sprintf("run `source %s` or open a new shell", rcFile)
+		}
+	}
+	return c
+}
+
+func checkRCFile() check {
+	c := check{name: "rc file"}
+	rcFile, err := path.RCFile()
+	switch {
+	case err != nil:
+		c.status, c.message = warn, err.Error()
+		c.fix = "add the binary path to $PATH manually"
+		return c
+	case rcFile == "":
+		c.message = "PATH is stored in the registry"
+		return c
+	}
+	f, err := os.OpenFile(rcFile, os.O_APPEND|os.O_WRONLY, 0644)
+	switch {
+	case os.IsNotExist(err):
+		c.message = fmt.Sprintf("%s doesn't exist yet, it is created by -install-path", rcFile)
+	case err != nil:
+		c.status, c.message = fail, fmt.Sprintf("%s is not writable: %s", rcFile, err)
+		c.fix = fmt.Sprintf("fix the permissions of %s or add the binary path to $PATH manually", rcFile)
+	default:
+		f.Close()
+		c.message = fmt.Sprintf("%s is writable", rcFile)
+	}
+	return c
+}
+
+// checkGithub checks GITHUB_TOKEN and the remaining api rate limit
+func checkGithub() []check {
+	token := check{name: "GITHUB_TOKEN"}
+	rate := check{name: "github rate limit"}
+	hasToken := os.Getenv("GITHUB_TOKEN") != ""
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	limits, _, err := utils.GithubClient().RateLimits(ctx)
+	var errResponse *github.ErrorResponse
+	switch {
+	case err != nil && hasToken && errors.As(err, &errResponse) && errResponse.Response.StatusCode == http.StatusUnauthorized:
+		token.status, token.message = fail, "token rejected by github"
+		token.fix = "create a new token and export it as GITHUB_TOKEN"
+		rate.status, rate.message = warn, "unknown, the token is rejected"
+		return []check{token, rate}
+	case err != nil:
+		rate.status, rate.message = fail, fmt.Sprintf("github api unreachable: %s", err)
+		rate.fix = "check the network connection and proxy settings"
+	case limits.Core != nil:
+		core := limits.Core
+		rate.message = fmt.Sprintf("%d/%d requests remaining", core.Remaining, core.Limit)
+		switch {
+		case core.Remaining == 0:
+			rate.status = fail
+			rate.message += fmt.Sprintf(", reset at %s", core.Reset.Format(time.Kitchen))
+			rate.fix = "wait for the reset or export GITHUB_TOKEN"
+		case core.Remaining < 10:
+			rate.status = warn
+			rate.fix = "export GITHUB_TOKEN to raise the limit to 5000 requests per hour"
+		}
+	}
+	if hasToken {
+		token.message = "set"
+		if err != nil {
+			token.message += ", not checked"
+		}
+	} else {
+		token.status, token.message = warn, "not set, github allows 60 unauthenticated requests per hour"
+		token.fix = "export GITHUB_TOKEN=<personal access token>"
+	}
+	return []check{token, rate}
+}
+
+func checkCache() check {
+	c := check{name: "cache"}
+	info, err := os.Stat(cacheFile)
+	switch {
+	case os.IsNotExist(err):
+		c.status, c.message = warn, fmt.Sprintf("%s doesn't exist, crtm can't work while the api is down", cacheFile)
+		c.fix = "run crtm once to create it"
+	case err != nil:
+		c.status, c.message = fail, err.Error()
+		c.fix = fmt.Sprintf("fix the permissions of %s", filepath.Dir(cacheFile))
+	case time.Since(info.ModTime()) > cacheMaxAge:
+		c.status, c.message = warn, fmt.Sprintf("%s is stale, last updated %s", cacheFile, info.ModTime().Format(time.RFC3339))
+		c.fix = "run crtm to refresh it"
+	default:
+		c.message = fmt.Sprintf("%s updated %s", cacheFile, info.ModTime().Format(time.RFC3339))
+	}
+	return c
+}
+
+// checkRequirements checks the requirements of installed tools
+func (r *Runner) checkRequirements() []check {
+	var checks []check
+	for _, entry := range utils.Registry.Tools {
+		tool := entry.Tool()
+		if _, exists := path.GetExecutablePath(r.options.Path, tool.Name); !exists {
+			continue
+		}
+		for _, spec := range getSpecs(tool) {
+			c := check{name: tool.Name + " requirement " + spec.Name}
+			if requirementSatisfied(spec.Name) {
+				c.message = "found"
+			} else {
+				c.status, c.message = warn, "missing (optional)"
+				if spec.Required {
+					c.status, c.message = fail, "missing (required)"
+				}
+				c.fix = getFormattedInstruction(spec)
+			}
+			checks = append(checks, c)
+		}
+	}
+	return checks
+}
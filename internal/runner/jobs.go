@@ -0,0 +1,63 @@
+package runner
+
+import (
+	"sync"
+
+	"github.com/projectdiscovery/gologger"
+	"github.com/projectdiscovery/gologger/formatter"
+	"github.com/projectdiscovery/gologger/levels"
+	"github.com/projectdiscovery/gologger/writer"
+)
+
+var (
+	// jobWriter writes the output of jobs, flushMu keeps the output of a job contiguous
+	jobWriter = writer.NewCLI()
+	flushMu   sync.Mutex
+)
+
+// jobOutput buffers the log lines of a job running concurrently with others until it is done
+type jobOutput struct {
+	mu    sync.Mutex
+	lines []jobLine
+}
+
+type jobLine struct {
+	data  []byte
+	level levels.Level
+}
+
+// Write implements writer.Writer
+func (o *jobOutput) Write(data []byte, level levels.Level) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.lines = append(o.lines, jobLine{data: append([]byte(nil), data...), level: level})
+}
+
+// Flush writes the buffered lines at once
+func (o *jobOutput) Flush() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	flushMu.Lock()
+	defer flushMu.Unlock()
+	for _, line := range o.lines {
+		jobWriter.Write(line.data, line.level)
+	}
+	o.lines = nil
+}
+
+// newJobLogger returns a logger with the level and format of the default logger buffering its output
+func (r *Runner) newJobLogger() (*gologger.Logger, *jobOutput) {
+	output := &jobOutput{}
+	logger := &gologger.Logger{}
+	logger.SetWriter(output)
+	logger.SetFormatter(formatter.NewCLI(r.options.NoColor))
+	switch {
+	case r.options.Silent:
+		logger.SetMaxLevel(levels.LevelSilent)
+	case r.options.Verbose:
+		logger.SetMaxLevel(levels.LevelVerbose)
+	default:
+		logger.SetMaxLevel(levels.LevelInfo)
+	}
+	return logger, output
+}
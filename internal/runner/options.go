@@ -1,10 +1,18 @@
 package runner
 
 import (
+	"fmt"
+	"github.com/chainreactors/crtm/pkg"
+	"github.com/chainreactors/crtm/pkg/httpclient"
+	"github.com/chainreactors/crtm/pkg/mirror"
+	"github.com/chainreactors/crtm/pkg/store"
 	"github.com/chainreactors/crtm/pkg/update"
+	toolversion "github.com/chainreactors/crtm/pkg/version"
 	updateutils "github.com/projectdiscovery/utils/update"
 	"os"
 	"path/filepath"
+	"runtime"
+	"time"
 
 	"github.com/logrusorgru/aurora/v4"
 	"github.com/projectdiscovery/goflags"
@@ -12,6 +20,7 @@ import (
 	"github.com/projectdiscovery/gologger/formatter"
 	"github.com/projectdiscovery/gologger/levels"
 	fileutil "github.com/projectdiscovery/utils/file"
+	"gopkg.in/yaml.v3"
 )
 
 var (
@@ -25,7 +34,9 @@ var (
 	}()
 
 	defaultConfigLocation = filepath.Join(homeDir, ".config/crtm/config.yaml")
+	defaultRegistryFile   = filepath.Join(homeDir, ".config/crtm/registry.yaml")
 	cacheFile             = filepath.Join(homeDir, ".config/crtm/cache.json")
+	defaultBundleFile     = "crtm-bundle.tar.gz"
 	defaultPath           = filepath.Join(homeDir, ".crtm/go/bin")
 )
 
@@ -33,19 +44,59 @@ var au *aurora.Aurora
 
 // Options contains the configuration options for tuning the enumeration process.
 type Options struct {
+	Command    string
+	Args       []string
 	ConfigFile string
+	Registry   goflags.StringSlice
 	Path       string
 	NoColor    bool
 	SetPath    bool
 	UnSetPath  bool
 
+	// Mirror are github download mirrors tried before the mirrors section of the config file
+	Mirror goflags.StringSlice
+	// Proxy, CACert, Insecure, Timeout and ReadTimeout configure the http clients
+	Proxy       string
+	CACert      string
+	Insecure    bool
+	Timeout     time.Duration
+	ReadTimeout time.Duration
+	// Retries and RateLimitWait configure the retries of failed requests
+	Retries       int
+	RateLimitWait time.Duration
+	// Segments is the number of parallel range requests large assets are downloaded with
+	Segments int
+
+	// Concurrency is the number of tools installed, updated or removed concurrently
+	Concurrency int
+
 	Install goflags.StringSlice
 	Update  goflags.StringSlice
 	Remove  goflags.StringSlice
+	// Frozen is a lockfile whose exact releases are installed
+	Frozen           string
+	RequireChecksums bool
+	AllowUnsigned    bool
+
+	// Tools, Platforms and Output select the content and location of a bundle
+	Tools     goflags.StringSlice
+	Platforms goflags.StringSlice
+	Output    string
+
+	KeepVersions int
+	Channel      string
+	// Constraints restricts updates of a tool to a semver range, it is read from the constraints section of the config file
+	Constraints map[string]string
+	// Channels is the release channel of a tool, it is read from the channels section of the config file
+	Channels map[string]string
+	// Mirrors are github api and download mirrors, they are read from the mirrors section of the config file
+	Mirrors []mirror.Rule
 
 	InstallAll bool
 	UpdateAll  bool
 	RemoveAll  bool
+	// Atomic restores every project changed by the run when one of its steps fails
+	Atomic bool
 
 	Verbose            bool
 	Silent             bool
@@ -61,23 +112,44 @@ func ParseOptions() *Options {
 	flagSet := goflags.NewFlagSet()
 
 	flagSet.SetDescription(`crtm is a simple and easy-to-use golang based tool for managing open source projects from ProjectDiscovery`)
+	flagSet.SetCustomHelpText(commandsHelp())
 
 	flagSet.CreateGroup("config", "Config",
 		flagSet.StringVar(&options.ConfigFile, "config", defaultConfigLocation, "cli flag configuration file"),
 		flagSet.StringVarP(&options.Path, "binary-path", "bp", defaultPath, "custom location to download project binary"),
+		flagSet.StringSliceVar(&options.Registry, "registry", nil, "tool registry file(s) merged over the default registry (comma separated)", goflags.CommaSeparatedStringSliceOptions),
+		flagSet.IntVarP(&options.Concurrency, "concurrency", "c", 1, "number of projects installed, updated or removed concurrently"),
+	)
+
+	flagSet.CreateGroup("network", "Network",
+		flagSet.StringSliceVarP(&options.Mirror, "mirror", "m", nil, "github download mirror tried in order before github, {url} or {path} are replaced else used as prefix (comma separated)", goflags.CommaSeparatedStringSliceOptions),
+		flagSet.StringVar(&options.Proxy, "proxy", "", "http, https or socks5 proxy url used for every request (default environment proxy)"),
+		flagSet.StringVar(&options.CACert, "ca-cert", "", "pem file of certificate authorities trusted in addition to the system ones"),
+		flagSet.BoolVar(&options.Insecure, "insecure", false, "disable tls certificate verification (unsafe)"),
+		flagSet.DurationVar(&options.Timeout, "timeout", httpclient.DefaultOptions.ConnectTimeout, "connection timeout"),
+		flagSet.DurationVarP(&options.ReadTimeout, "read-timeout", "rt", httpclient.DefaultOptions.ReadTimeout, "read timeout of responses"),
+		flagSet.IntVar(&options.Retries, "retries", httpclient.DefaultOptions.Retries, "number of retries of requests failing with a transient error"),
+		flagSet.DurationVarP(&options.RateLimitWait, "rate-limit-wait", "rlw", httpclient.DefaultOptions.RateLimitWait, "longest wait for the reset of an exhausted api rate limit"),
+		flagSet.IntVar(&options.Segments, "segments", pkg.DownloadSegments, "number of parallel range requests large assets are downloaded with"),
 	)
 
 	flagSet.CreateGroup("install", "Install",
-		flagSet.StringSliceVarP(&options.Install, "install", "i", nil, "install single or multiple project by name (comma separated)", goflags.NormalizedStringSliceOptions),
+		flagSet.StringSliceVarP(&options.Install, "install", "i", nil, "install single or multiple project by name, name@version installs a specific release (comma separated)", goflags.NormalizedStringSliceOptions),
 		flagSet.BoolVarP(&options.InstallAll, "install-all", "ia", false, "install all the projects"),
+		flagSet.StringVar(&options.Frozen, "frozen", "", "install the exact releases recorded in a lockfile (crtm.lock), fails on checksum mismatch"),
 		flagSet.BoolVarP(&options.SetPath, "install-path", "ip", false, "append path to PATH environment variables"),
+		flagSet.BoolVarP(&options.RequireChecksums, "require-checksums", "rc", false, "refuse to install or update projects whose release has no checksum file"),
+		flagSet.BoolVarP(&options.AllowUnsigned, "allow-unsigned", "au", false, "install releases with a missing or bad signature for projects with pinned keys"),
 	)
 
 	flagSet.CreateGroup("update", "Update",
-		flagSet.StringSliceVarP(&options.Update, "update", "u", nil, "update single or multiple project by name (comma separated)", goflags.NormalizedStringSliceOptions),
+		flagSet.StringSliceVarP(&options.Update, "update", "u", nil, "update single or multiple project by name, name@version updates to a specific release (comma separated)", goflags.NormalizedStringSliceOptions),
 		flagSet.BoolVarP(&options.UpdateAll, "update-all", "ua", false, "update all the projects"),
 		flagSet.CallbackVarP(GetUpdateCallback(), "self-update", "up", "update crtm to latest version"),
 		flagSet.BoolVarP(&options.DisableUpdateCheck, "disable-update-check", "duc", false, "disable automatic crtm update check"),
+		flagSet.StringVarP(&options.Channel, "channel", "ch", string(toolversion.Stable), "release channel followed by projects (stable, beta, dev)"),
+		flagSet.IntVarP(&options.KeepVersions, "keep-versions", "kv", store.Generations, "number of previous versions kept for rollback after an update"),
+		flagSet.BoolVar(&options.Atomic, "atomic", false, "all or nothing, restore every updated or installed project if any of them fails"),
 	)
 
 	flagSet.CreateGroup("remove", "Remove",
@@ -86,6 +158,12 @@ func ParseOptions() *Options {
 		flagSet.BoolVarP(&options.UnSetPath, "remove-path", "rp", false, "remove path from PATH environment variables"),
 	)
 
+	flagSet.CreateGroup("bundle", "Bundle",
+		flagSet.StringSliceVarP(&options.Tools, "tools", "t", nil, "projects added to the bundle, default all (comma separated)", goflags.NormalizedStringSliceOptions),
+		flagSet.StringSliceVarP(&options.Platforms, "platforms", "pl", nil, "platforms added to the bundle as os/arch, default current platform (comma separated)", goflags.NormalizedStringSliceOptions),
+		flagSet.StringVarP(&options.Output, "output", "o", defaultBundleFile, "bundle file written by bundle create"),
+	)
+
 	flagSet.CreateGroup("debug", "Debug",
 		flagSet.BoolVarP(&options.ShowPath, "show-path", "sp", false, "show the current binary path then exit"),
 		flagSet.BoolVar(&options.Version, "version", false, "show version of the project"),
@@ -98,10 +176,29 @@ func ParseOptions() *Options {
 		gologger.Fatal().Msgf("%s\n", err)
 	}
 
+	// the first positional argument selects a command, flags are accepted before and after it
+	args := flagSet.CommandLine.Args()
+	for len(args) > 0 {
+		options.Args = append(options.Args, args[0])
+		if err := flagSet.CommandLine.Parse(args[1:]); err != nil {
+			gologger.Fatal().Msgf("%s\n", err)
+		}
+		args = flagSet.CommandLine.Args()
+	}
+	if len(options.Args) > 0 {
+		options.Command, options.Args = options.Args[0], options.Args[1:]
+		if _, ok := getCommand(options.Command); !ok {
+			gologger.Fatal().Msgf("unknown command %s\n\n%s", options.Command, commandsHelp())
+		}
+	}
+
 	// configure aurora for logging
 	au = aurora.New(aurora.WithColors(true))
 
 	options.configureOutput()
+	if err := options.configureNetwork(); err != nil {
+		gologger.Fatal().Msgf("Could not configure http client: %s\n", err)
+	}
 
 	//showBanner()
 
@@ -116,6 +213,15 @@ func ParseOptions() *Options {
 		os.Exit(0)
 	}
 
+	if options.ConfigFile != defaultConfigLocation {
+		_ = options.loadConfigFrom(options.ConfigFile)
+	}
+	if err := options.loadToolConfig(options.ConfigFile); err != nil {
+		gologger.Fatal().Msgf("Could not read tool configuration: %s\n", err)
+	}
+	// mirrors are needed by the crtm version check
+	mirror.Rules = append(mirror.ParseDownloadRules(options.Mirror), options.Mirrors...)
+
 	gologger.Info().Msgf("Current crtm version %v", version)
 	if !options.DisableUpdateCheck {
 		latestVersion, err := update.GetToolVersionCallback("crtm", version)()
@@ -128,13 +234,26 @@ func ParseOptions() *Options {
 		}
 	}
 
-	if options.ConfigFile != defaultConfigLocation {
-		_ = options.loadConfigFrom(options.ConfigFile)
-	}
-
 	return options
 }
 
+// configureNetwork configures the http clients used for every request
+func (options *Options) configureNetwork() error {
+	if options.Insecure {
+		gologger.Warning().Msgf("tls certificate verification is disabled")
+	}
+	return httpclient.Configure(httpclient.Options{
+		Proxy:          options.Proxy,
+		CACert:         options.CACert,
+		Insecure:       options.Insecure,
+		ConnectTimeout: options.Timeout,
+		ReadTimeout:    options.ReadTimeout,
+		Retries:        options.Retries,
+		RateLimitWait:  options.RateLimitWait,
+		UserAgent:      fmt.Sprintf("crtm/%s (%s/%s)", version, runtime.GOOS, runtime.GOARCH),
+	})
+}
+
 // configureOutput configures the output on the screen
 func (options *Options) configureOutput() {
 	// If the user desires verbose output, show verbose output
@@ -153,3 +272,35 @@ func (options *Options) configureOutput() {
 func (options *Options) loadConfigFrom(location string) error {
 	return fileutil.Unmarshal(fileutil.YAML, []byte(location), options)
 }
+
+// loadToolConfig reads the per tool version constraints, release channels and github mirrors of the config file
+//
+//	constraints:
+//	  gogo: "~2.11"
+//	  zombie: ">=1.2 <2"
+//	channels:
+//	  spray: beta
+//	mirrors:
+//	  - api: https://ghapi.example.com
+//	    download: https://ghproxy.example.com/
+func (options *Options) loadToolConfig(location string) error {
+	data, err := os.ReadFile(location)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	config := struct {
+		Constraints map[string]string `yaml:"constraints"`
+		Channels    map[string]string `yaml:"channels"`
+		Mirrors     []mirror.Rule     `yaml:"mirrors"`
+	}{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return err
+	}
+	options.Constraints = config.Constraints
+	options.Channels = config.Channels
+	options.Mirrors = config.Mirrors
+	return nil
+}
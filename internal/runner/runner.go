@@ -9,11 +9,18 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/chainreactors/crtm/pkg"
 	"github.com/chainreactors/crtm/pkg/path"
+	"github.com/chainreactors/crtm/pkg/plan"
+	"github.com/chainreactors/crtm/pkg/registry"
+	"github.com/chainreactors/crtm/pkg/signature"
+	"github.com/chainreactors/crtm/pkg/store"
 	"github.com/chainreactors/crtm/pkg/types"
 	"github.com/chainreactors/crtm/pkg/utils"
+	toolversion "github.com/chainreactors/crtm/pkg/version"
 	"github.com/projectdiscovery/gologger"
 	errorutil "github.com/projectdiscovery/utils/errors"
 	osutils "github.com/projectdiscovery/utils/os"
@@ -30,6 +37,53 @@ type Runner struct {
 
 // NewRunner instance
 func NewRunner(options *Options) (*Runner, error) {
+	registryFiles := append([]string{defaultRegistryFile}, options.Registry...)
+	toolRegistry, err := registry.Load(registryFiles...)
+	if err != nil {
+		return nil, err
+	}
+	utils.Registry = toolRegistry
+	if options.Atomic && (len(options.Remove) > 0 || options.RemoveAll) {
+		// removed projects can't be restored, their versions are deleted from the store
+		return nil, errors.New("-atomic can't be used to remove projects")
+	}
+	if options.KeepVersions < 0 {
+		return nil, fmt.Errorf("invalid -keep-versions %d, must be 0 or more", options.KeepVersions)
+	}
+	store.Generations = options.KeepVersions
+	if options.Atomic && store.Generations < 1 {
+		// the replaced versions are needed to restore updated projects
+		store.Generations = 1
+	}
+	pkg.RequireChecksums = options.RequireChecksums
+	pkg.DownloadSegments = options.Segments
+	signature.AllowUnsigned = options.AllowUnsigned
+	for toolName, constraint := range options.Constraints {
+		entry, ok := toolRegistry.Get(toolName)
+		if !ok {
+			gologger.Warning().Msgf("ignoring version constraint of unknown tool %s", toolName)
+			continue
+		}
+		if _, err := semver.NewConstraint(constraint); err != nil {
+			gologger.Error().Msgf("invalid version constraint %q of %s, it is not updated until fixed: %s", constraint, toolName, err)
+		}
+		utils.Constraints[entry.Name] = constraint
+	}
+	if utils.Channel, err = toolversion.ParseChannel(options.Channel); err != nil {
+		return nil, err
+	}
+	for toolName, channelName := range options.Channels {
+		entry, ok := toolRegistry.Get(toolName)
+		if !ok {
+			gologger.Warning().Msgf("ignoring release channel of unknown tool %s", toolName)
+			continue
+		}
+		channel, err := toolversion.ParseChannel(channelName)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", toolName, err)
+		}
+		utils.Channels[entry.Name] = channel
+	}
 	return &Runner{
 		options: options,
 	}, nil
@@ -58,33 +112,15 @@ func (r *Runner) Run() error {
 	if err != nil {
 		return err
 	}
-	toolListApi, err := utils.FetchToolList()
-	var toolList []types.Tool
-
-	for _, tool := range toolListApi {
-		if !stringsutil.ContainsAny(tool.Name, excludedToolList...) {
-			toolList = append(toolList, tool)
-		}
+	if r.options.Command != "" {
+		return r.runCommand()
 	}
-
-	// if toolList is not nil save/update the cache
-	// else fetch from cache file
-	if toolList != nil {
-		go func() {
-			if err := UpdateCache(toolList); err != nil {
-				gologger.Warning().Msgf("%s\n", err)
-			}
-		}()
-	} else {
-		toolList, err = FetchFromCache()
-		if err != nil {
-			return errors.New("github api is down, please try again later")
-		}
-		if toolList != nil {
-			gologger.Warning().Msg("github api is down, using cached information while we fix the issue \n\n")
-		}
+	if r.options.Frozen != "" {
+		return r.installFrozen()
 	}
-	if toolList == nil && err != nil {
+
+	toolList, err := r.fetchToolList()
+	if err != nil {
 		return err
 	}
 
@@ -94,8 +130,11 @@ func (r *Runner) Run() error {
 			r.options.Install = append(r.options.Install, tool.Name)
 		}
 	case r.options.UpdateAll:
+		// only installed projects are updated, the others aren't failures
 		for _, tool := range toolList {
-			r.options.Update = append(r.options.Update, tool.Name)
+			if _, installed := path.GetExecutablePath(r.options.Path, tool.Name); installed {
+				r.options.Update = append(r.options.Update, tool.Name)
+			}
 		}
 	case r.options.RemoveAll:
 		for _, tool := range toolList {
@@ -104,73 +143,278 @@ func (r *Runner) Run() error {
 	}
 	gologger.Verbose().Msgf("using path %s", r.options.Path)
 
-	for _, toolName := range r.options.Install {
-		if !path.IsSubPath(homeDir, r.options.Path) {
-			gologger.Error().Msgf("skipping install outside home folder: %s", toolName)
-			continue
+	p, failed := r.flagsPlan(toolList)
+	if r.options.Atomic && failed > 0 {
+		return fmt.Errorf("%d projects could not be resolved, nothing was changed", failed)
+	}
+	applied, failed := r.apply(p)
+	if r.options.Atomic && failed > 0 {
+		if err := r.restore(applied); err != nil {
+			return fmt.Errorf("%d steps failed, some projects could not be restored: %w", failed, err)
 		}
-		if i, ok := utils.Contains(toolList, toolName); ok {
-			tool := toolList[i]
-			//if tool.InstallType == types.Go && isGoInstalled() {
-			//	if err := pkg.GoInstall(r.options.Path, tool); err != nil {
-			//		gologger.Error().Msgf("%s: %s", tool.Name, err)
-			//	}
-			//	printRequirementInfo(tool)
-			//	continue
-			//}
+		return fmt.Errorf("%d steps failed, every project was restored", failed)
+	}
+	if len(r.options.Install) == 0 && len(r.options.Update) == 0 && len(r.options.Remove) == 0 {
+		return r.ListToolsAndEnv(toolList)
+	}
+	return nil
+}
 
-			if err := pkg.Install(r.options.Path, tool); err != nil {
-				if errors.Is(err, types.ErrIsInstalled) {
-					gologger.Info().Msgf("%s: %s", tool.Name, err)
-				} else {
-					gologger.Error().Msgf("error while installing %s: %s", tool.Name, err)
-					//gologger.Info().Msgf("trying to install %s using go install", tool.Name)
-					//if err := pkg.GoInstall(r.options.Path, tool); err != nil {
-					//	gologger.Error().Msgf("%s: %s", tool.Name, err)
-					//}
-				}
-			}
-			printRequirementInfo(tool)
-		} else {
+// flagsPlan returns the steps requested by the install, update and remove flags
+// and the number of requested projects that couldn't be found or fetched
+func (r *Runner) flagsPlan(toolList []types.Tool) (plan.Plan, int) {
+	var p plan.Plan
+	var failed int
+	for _, toolArg := range r.options.Install {
+		toolName, toolVersion := utils.ParseToolVersion(toolArg)
+		i, ok := utils.Contains(toolList, toolName)
+		if !ok {
 			gologger.Error().Msgf("error while installing %s: %s not found in the list", toolName, toolName)
+			failed++
+			continue
 		}
+		tool := toolList[i]
+		if toolVersion != "" {
+			var err error
+			if tool, err = utils.FetchToolVersion(tool.Name, toolVersion); err != nil {
+				gologger.Error().Msgf("error while installing %s: %s", toolArg, err)
+				failed++
+				continue
+			}
+		}
+		p = append(p, plan.Step{Action: plan.Install, Tool: tool})
 	}
-	for _, tool := range r.options.Update {
-		if !path.IsSubPath(homeDir, r.options.Path) {
-			gologger.Error().Msgf("skipping update outside home folder: %s", tool)
+	for _, toolArg := range r.options.Update {
+		toolName, toolVersion := utils.ParseToolVersion(toolArg)
+		i, ok := utils.Contains(toolList, toolName)
+		if !ok {
+			gologger.Error().Msgf("error while updating %s: %s not found in the list", toolName, toolName)
+			failed++
 			continue
 		}
-		if i, ok := utils.Contains(toolList, tool); ok {
-			if err := pkg.Update(r.options.Path, toolList[i], r.options.DisableChangeLog); err != nil {
-				if err == types.ErrIsUpToDate {
-					gologger.Info().Msgf("%s: %s", tool, err)
-				} else {
-					gologger.Info().Msgf("%s\n", err)
-				}
+		tool := toolList[i]
+		if toolVersion != "" {
+			var err error
+			if tool, err = utils.FetchToolVersion(tool.Name, toolVersion); err != nil {
+				gologger.Error().Msgf("error while updating %s: %s", toolArg, err)
+				failed++
+				continue
 			}
 		}
+		p = append(p, plan.Step{Action: plan.Update, Tool: tool})
+	}
+	for _, toolName := range r.options.Remove {
+		if i, ok := utils.Contains(toolList, toolName); ok {
+			p = append(p, plan.Step{Action: plan.Remove, Tool: toolList[i]})
+		}
 	}
-	for _, tool := range r.options.Remove {
-		if !path.IsSubPath(homeDir, r.options.Path) {
-			gologger.Error().Msgf("skipping remove outside home folder: %s", tool)
+	return p, failed
+}
+
+// apply applies the steps of a plan with -concurrency workers, a failing step is logged and doesn't
+// stop the next ones. The steps of a tool run in order and their output is printed at once when done.
+// The steps that changed a tool and the number of failed steps are returned.
+func (r *Runner) apply(p plan.Plan) (plan.Plan, int) {
+	var order []string
+	steps := map[string][]plan.Step{}
+	for _, step := range p {
+		if step.Action == plan.Keep {
 			continue
 		}
-		if i, ok := utils.Contains(toolList, tool); ok {
-			if err := pkg.Remove(r.options.Path, toolList[i]); err != nil {
-				var notFoundError *exec.Error
-				if errors.As(err, &notFoundError) {
-					gologger.Info().Msgf("%s: not found", tool)
-				} else {
-					gologger.Info().Msgf("%s\n", err)
+		if _, ok := steps[step.Tool.Name]; !ok {
+			order = append(order, step.Tool.Name)
+		}
+		steps[step.Tool.Name] = append(steps[step.Tool.Name], step)
+	}
+
+	var applied plan.Plan
+	var failed int
+	mu := &sync.Mutex{}
+	run := func(log *gologger.Logger, step plan.Step) {
+		changed, err := r.applyStep(log, step)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			failed++
+		} else if changed {
+			applied = append(applied, step)
+		}
+	}
+
+	workers := r.options.Concurrency
+	if workers > len(order) {
+		workers = len(order)
+	}
+	if workers <= 1 {
+		for _, toolName := range order {
+			for _, step := range steps[toolName] {
+				run(gologger.DefaultLogger, step)
+			}
+		}
+		return applied, failed
+	}
+	jobs := make(chan string)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for toolName := range jobs {
+				log, output := r.newJobLogger()
+				pkg.SetLogger(toolName, log)
+				for _, step := range steps[toolName] {
+					run(log, step)
 				}
+				pkg.SetLogger(toolName, nil)
+				output.Flush()
 			}
+		}()
+	}
+	for _, toolName := range order {
+		jobs <- toolName
+	}
+	close(jobs)
+	wg.Wait()
+	return applied, failed
+}
 
+// applyStep applies a step of a plan and logs its result to log. It returns whether the tool was
+// changed and the error of a failed step, tools already installed or up to date aren't failures.
+func (r *Runner) applyStep(log *gologger.Logger, step plan.Step) (bool, error) {
+	tool := step.Tool
+	if !path.IsSubPath(homeDir, r.options.Path) {
+		err := fmt.Errorf("skipping %s outside home folder: %s", step.Action, tool.Name)
+		log.Error().Msgf("%s", err)
+		return false, err
+	}
+	switch step.Action {
+	case plan.Install:
+		//if tool.InstallType == types.Go && isGoInstalled() {
+		//	if err := pkg.GoInstall(r.options.Path, tool); err != nil {
+		//		gologger.Error().Msgf("%s: %s", tool.Name, err)
+		//	}
+		//	printRequirementInfo(tool)
+		//	continue
+		//}
+		err := pkg.Install(r.options.Path, tool)
+		changed := err == nil
+		switch {
+		case errors.Is(err, types.ErrIsInstalled):
+			log.Info().Msgf("%s: %s", tool.Name, err)
+			err = nil
+		case errors.Is(err, types.ErrOutsideConstraint):
+			log.Error().Msgf("%s: %s, skipping install", tool.Name, err)
+			err = nil
+		case err != nil:
+			log.Error().Msgf("error while installing %s: %s", tool.Name, err)
+			//gologger.Info().Msgf("trying to install %s using go install", tool.Name)
+			//if err := pkg.GoInstall(r.options.Path, tool); err != nil {
+			//	gologger.Error().Msgf("%s: %s", tool.Name, err)
+			//}
+		}
+		printRequirementInfo(log, tool)
+		return changed, err
+	case plan.Update, plan.Downgrade:
+		err := pkg.Update(r.options.Path, tool, r.options.DisableChangeLog)
+		switch {
+		case err == types.ErrIsUpToDate:
+			log.Info().Msgf("%s: %s", tool.Name, err)
+			return false, nil
+		case errors.Is(err, types.ErrOutsideConstraint):
+			log.Error().Msgf("%s: %s, skipping update", tool.Name, err)
+			return false, nil
+		case err != nil:
+			log.Info().Msgf("%s\n", err)
+			return false, err
+		}
+	case plan.Remove:
+		if err := pkg.Remove(r.options.Path, tool); err != nil {
+			var notFoundError *exec.Error
+			if errors.As(err, &notFoundError) {
+				log.Info().Msgf("%s: not found", tool.Name)
+				return false, nil
+			}
+			log.Info().Msgf("%s\n", err)
+			return false, err
 		}
 	}
-	if len(r.options.Install) == 0 && len(r.options.Update) == 0 && len(r.options.Remove) == 0 {
-		return r.ListToolsAndEnv(toolList)
+	return true, nil
+}
+
+// restore reverts the steps applied by an atomic run, updated projects are rolled back
+// to the version they replaced and installed projects are removed. The errors of the
+// projects that couldn't be restored are returned.
+func (r *Runner) restore(applied plan.Plan) error {
+	var errs []error
+	for _, step := range applied {
+		var err error
+		switch step.Action {
+		case plan.Update, plan.Downgrade:
+			err = pkg.Rollback(r.options.Path, step.Tool)
+		case plan.Install:
+			err = pkg.Remove(r.options.Path, step.Tool)
+		default:
+			err = fmt.Errorf("can't restore %s step", step.Action)
+		}
+		if err != nil {
+			gologger.Error().Msgf("could not restore %s: %s", step.Tool.Name, err)
+			errs = append(errs, fmt.Errorf("%s: %w", step.Tool.Name, err))
+		}
 	}
-	return nil
+	return errors.Join(errs...)
+}
+
+// fetchToolList returns the latest release of registry tools, the cached release of a tool is
+// used when it can't be fetched (api down, rate limit exhausted...)
+func (r *Runner) fetchToolList() ([]types.Tool, error) {
+	toolListApi, err := utils.FetchToolList()
+	fetched := map[string]types.Tool{}
+	for _, tool := range toolListApi {
+		fetched[tool.Name] = tool
+	}
+	var cached map[string]types.Tool
+	if err != nil {
+		gologger.Verbose().Msgf("%s", err)
+		cachedList, _ := FetchFromCache()
+		cached = make(map[string]types.Tool, len(cachedList))
+		for _, tool := range cachedList {
+			cached[tool.Name] = tool
+		}
+	}
+
+	var toolList []types.Tool
+	var fallback, missing []string
+	for _, entry := range utils.Registry.Tools {
+		if stringsutil.ContainsAny(entry.Name, excludedToolList...) {
+			continue
+		}
+		if tool, ok := fetched[entry.Name]; ok {
+			toolList = append(toolList, tool)
+		} else if tool, ok := cached[entry.Name]; ok {
+			toolList = append(toolList, tool)
+			fallback = append(fallback, entry.Name)
+		} else if err != nil {
+			missing = append(missing, entry.Name)
+		}
+	}
+	if len(fallback) > 0 {
+		gologger.Warning().Msgf("could not fetch %s, using cached information", strings.Join(fallback, ", "))
+	}
+	if len(missing) > 0 {
+		gologger.Error().Msgf("could not fetch %s and no cached information, run with -v for details", strings.Join(missing, ", "))
+	}
+	if toolList == nil {
+		if err != nil {
+			return nil, errors.New("github api is down, please try again later")
+		}
+		return nil, nil
+	}
+	go func() {
+		if err := UpdateCache(toolList); err != nil {
+			gologger.Warning().Msgf("%s\n", err)
+		}
+	}()
+	return toolList, nil
 }
 
 func isGoInstalled() bool {
@@ -181,7 +425,7 @@ func isGoInstalled() bool {
 	return true
 }
 
-func printRequirementInfo(tool types.Tool) {
+func printRequirementInfo(log *gologger.Logger, tool types.Tool) {
 	specs := getSpecs(tool)
 
 	printTitle := true
@@ -199,7 +443,7 @@ func printRequirementInfo(tool types.Tool) {
 		stringBuilder.WriteString(fmt.Sprintf("%s %s\n", isRequired, instruction))
 	}
 	if stringBuilder.Len() > 0 {
-		gologger.Info().Msgf("%s", stringBuilder.String())
+		log.Info().Msgf("%s", stringBuilder.String())
 	}
 }
 
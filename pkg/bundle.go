@@ -0,0 +1,201 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/chainreactors/crtm/pkg/bundle"
+	"github.com/chainreactors/crtm/pkg/cache"
+	"github.com/chainreactors/crtm/pkg/lockfile"
+	"github.com/chainreactors/crtm/pkg/registry"
+	"github.com/chainreactors/crtm/pkg/signature"
+	"github.com/chainreactors/crtm/pkg/state"
+	"github.com/chainreactors/crtm/pkg/types"
+	"github.com/chainreactors/crtm/pkg/update"
+	"github.com/chainreactors/crtm/pkg/utils"
+	"github.com/projectdiscovery/gologger"
+)
+
+// AddToBundle adds the release assets of tool for given platforms to the bundle with the
+// release checksums file and notes. Assets are downloaded through the download cache.
+func AddToBundle(w *bundle.Writer, entry registry.Entry, tool types.Tool, platforms []string) error {
+	bundled := bundle.Tool{Name: tool.Name, Version: tool.Version, Assets: map[string]lockfile.Asset{}}
+
+	checksumsName, checksumsData, err := releaseChecksumsFile(tool)
+	var checksums map[string]string
+	switch {
+	case errors.Is(err, types.ErrNoChecksum):
+		if RequireChecksums {
+			return fmt.Errorf("%s %s: %w", tool.Name, tool.Version, err)
+		}
+	case err != nil:
+		return err
+	default:
+		if checksums, err = update.ParseChecksums(checksumsData); err != nil {
+			return err
+		}
+		bundled.Checksums = checksumsName
+		if err := w.AddData(path.Join(bundled.Dir(), checksumsName), checksumsData); err != nil {
+			return err
+		}
+		if signatureName := checksumsName + signature.Ext; hasAsset(tool, signatureName) {
+			sig, err := readAsset(tool, signatureName)
+			if err != nil {
+				return err
+			}
+			bundled.Signature = signatureName
+			if err := w.AddData(path.Join(bundled.Dir(), signatureName), sig); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, platform := range platforms {
+		goos, goarch, _ := strings.Cut(platform, "/")
+		assetName, _, ok := findAsset(tool, goos, goarch)
+		if !ok {
+			gologger.Warning().Msgf("%s %s: no release asset for %s", tool.Name, tool.Version, platform)
+			continue
+		}
+		blob, sum, err := cachedAsset(tool, assetName, checksums[assetName])
+		if err != nil {
+			return err
+		}
+		if err := w.AddFile(path.Join(bundled.Dir(), assetName), blob); err != nil {
+			return err
+		}
+		bundled.Assets[platform] = lockfile.Asset{Name: assetName, SHA256: sum}
+	}
+	if len(bundled.Assets) == 0 {
+		return fmt.Errorf("%s %s: no release asset found for %s", tool.Name, tool.Version, strings.Join(platforms, ", "))
+	}
+
+	if release, err := utils.FetchRelease(tool, tool.Version); err == nil && release.Body != "" {
+		bundled.Notes = bundle.NotesFile
+		if err := w.AddData(path.Join(bundled.Dir(), bundle.NotesFile), []byte(release.Body)); err != nil {
+			return err
+		}
+	}
+	w.Manifest.Tools = append(w.Manifest.Tools, bundled)
+	w.Registry.Merge(&registry.Registry{Tools: []registry.Entry{entry}})
+	return nil
+}
+
+// InstallFromBundle installs the bundled release of a tool for the current platform at path.
+// The asset is checked against the bundle manifest and checksums then imported in the download
+// cache, so that it is installed without network access.
+func InstallFromBundle(path, dir string, entry registry.Entry, bundled bundle.Tool) error {
+	asset, ok := bundled.Assets[lockfile.Platform(runtime.GOOS, runtime.GOARCH)]
+	if !ok {
+		return fmt.Errorf("%s %s: no bundled asset for %s/%s", bundled.Name, bundled.Version, runtime.GOOS, runtime.GOARCH)
+	}
+	assetPath := filepath.Join(dir, filepath.FromSlash(bundled.Dir()), asset.Name)
+	sum, err := state.HashFile(assetPath)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(sum, asset.SHA256) {
+		return fmt.Errorf("%s: checksum mismatch expected %s but got %s", asset.Name, asset.SHA256, sum)
+	}
+	var checksums map[string]string
+	var checksumsData []byte
+	if bundled.Checksums != "" {
+		if checksumsData, err = os.ReadFile(filepath.Join(dir, filepath.FromSlash(bundled.Dir()), bundled.Checksums)); err != nil {
+			return err
+		}
+		if checksums, err = update.ParseChecksums(checksumsData); err != nil {
+			return err
+		}
+		if expected, ok := checksums[asset.Name]; ok && !strings.EqualFold(expected, sum) {
+			return fmt.Errorf("%s: checksum mismatch expected %s but got %s", asset.Name, expected, sum)
+		}
+	}
+
+	tool := entry.Tool()
+	tool.Version = bundled.Version
+	if err := verifyBundleSignature(tool, dir, bundled, checksumsData, checksums, asset.Name); err != nil {
+		return err
+	}
+	defer lockTool(tool.Name)()
+	tool.Assets = map[string]int64{asset.Name: 0}
+	tool.Checksums = map[string]string{asset.Name: sum}
+	tool.Pinned = true
+	if err := cache.Import(assetPath, tool.RepoPath(), tool.Version, asset.Name, sum, false); err != nil {
+		return err
+	}
+	gologger.Info().Msgf("installing %s %s from bundle...", tool.Name, tool.Version)
+	version, err := install(tool, path)
+	if err != nil {
+		return err
+	}
+	gologger.Info().Msgf("installed %s %s (%s)", tool.Name, version, au.BrightGreen("bundle").String())
+	return nil
+}
+
+// verifyBundleSignature verifies the bundled signature of the checksums file when keys are pinned
+// for the tool, the asset must be listed in the signed checksums file
+func verifyBundleSignature(tool types.Tool, dir string, bundled bundle.Tool, data []byte, checksums map[string]string, assetName string) error {
+	keys, err := pinnedKeys(tool)
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+	if bundled.Checksums == "" || bundled.Signature == "" {
+		return allowUnsigned(tool, fmt.Errorf("%s: %w", assetName, signature.ErrUnsigned))
+	}
+	sig, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(bundled.Dir()), bundled.Signature))
+	if err != nil {
+		return err
+	}
+	if err := signature.Verify(keys, data, sig); err != nil {
+		return allowUnsigned(tool, fmt.Errorf("%s: %w", bundled.Checksums, err))
+	}
+	if _, ok := checksums[assetName]; !ok {
+		return allowUnsigned(tool, fmt.Errorf("%s: %w", assetName, signature.ErrUnsigned))
+	}
+	gologger.Verbose().Msgf("verified signature of %s", bundled.Checksums)
+	return nil
+}
+
+// cachedAsset returns the path of the release asset in the download cache and its sha256,
+// the asset is downloaded if it isn't cached yet
+func cachedAsset(tool types.Tool, assetName, expected string) (string, string, error) {
+	repo := tool.RepoPath()
+	if blob, entry, ok := cache.Open(repo, tool.Version, assetName); ok {
+		blob.Close()
+		if expected != "" && !strings.EqualFold(expected, entry.SHA256) {
+			return "", "", fmt.Errorf("%s: checksum mismatch expected %s but cached %s", assetName, expected, entry.SHA256)
+		}
+		return cache.BlobPath(entry.SHA256), entry.SHA256, nil
+	}
+	body, err := openAsset(tool, assetName)
+	if err != nil {
+		return "", "", err
+	}
+	defer body.Close()
+	f, err := cache.Create()
+	if err != nil {
+		return "", "", err
+	}
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, hasher), body); err != nil {
+		cache.Discard(f)
+		return "", "", err
+	}
+	sum := hex.EncodeToString(hasher.Sum(nil))
+	if expected != "" && !strings.EqualFold(expected, sum) {
+		cache.Discard(f)
+		return "", "", fmt.Errorf("%s: checksum mismatch expected %s but got %s", assetName, expected, sum)
+	}
+	if err := cache.Commit(f, repo, tool.Version, assetName, sum, expected != "" && !signature.AllowUnsigned); err != nil {
+		return "", "", err
+	}
+	return cache.BlobPath(sum), sum, nil
+}
@@ -0,0 +1,181 @@
+// Package bundle contains the archive format used to move tools into air-gapped networks.
+//
+// A bundle is a tar.gz holding manifest.json, a registry.yaml snapshot of the bundled tools
+// and the release files of every tool under <tool>/<version>/ (assets, checksums file and
+// its signature, release notes).
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/chainreactors/crtm/pkg/extract"
+	"github.com/chainreactors/crtm/pkg/lockfile"
+	"github.com/chainreactors/crtm/pkg/registry"
+	errorutil "github.com/projectdiscovery/utils/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// SchemaVersion is the latest bundle format understood by crtm
+const SchemaVersion = 1
+
+const (
+	ManifestFile = "manifest.json"
+	RegistryFile = "registry.yaml"
+	NotesFile    = "RELEASE_NOTES.md"
+)
+
+// Manifest describes the content of a bundle
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Tools     []Tool    `json:"tools"`
+}
+
+// Tool is a bundled tool release, Assets are keyed by platform (os/arch)
+type Tool struct {
+	Name      string                    `json:"name"`
+	Version   string                    `json:"version"`
+	Checksums string                    `json:"checksums,omitempty"`
+	Signature string                    `json:"signature,omitempty"`
+	Notes     string                    `json:"notes,omitempty"`
+	Assets    map[string]lockfile.Asset `json:"assets"`
+}
+
+// Dir returns the directory of the release files of a tool in the bundle
+func (t Tool) Dir() string {
+	return path.Join(t.Name, t.Version)
+}
+
+// Writer writes a bundle, the manifest and registry snapshot are written on Close
+type Writer struct {
+	file     *os.File
+	gz       *gzip.Writer
+	tw       *tar.Writer
+	Manifest Manifest
+	Registry registry.Registry
+}
+
+// Create creates a bundle at path
+func Create(path string) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(f)
+	return &Writer{
+		file:     f,
+		gz:       gz,
+		tw:       tar.NewWriter(gz),
+		Manifest: Manifest{Version: SchemaVersion, CreatedAt: time.Now()},
+		Registry: registry.Registry{Version: registry.SchemaVersion},
+	}, nil
+}
+
+// AddFile adds the file at src to the bundle as name
+func (w *Writer) AddFile(name, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := w.tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: info.Size(), ModTime: info.ModTime()}); err != nil {
+		return err
+	}
+	_, err = io.Copy(w.tw, f)
+	return err
+}
+
+// AddData adds data to the bundle as name
+func (w *Writer) AddData(name string, data []byte) error {
+	if err := w.tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}); err != nil {
+		return err
+	}
+	_, err := w.tw.Write(data)
+	return err
+}
+
+// Close writes the manifest and registry snapshot then closes the bundle
+func (w *Writer) Close() error {
+	manifest, err := json.MarshalIndent(w.Manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := w.AddData(ManifestFile, manifest); err != nil {
+		return err
+	}
+	snapshot, err := yaml.Marshal(w.Registry)
+	if err != nil {
+		return err
+	}
+	if err := w.AddData(RegistryFile, snapshot); err != nil {
+		return err
+	}
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	if err := w.gz.Close(); err != nil {
+		return err
+	}
+	return w.file.Close()
+}
+
+// Abort closes and removes an incomplete bundle
+func (w *Writer) Abort() {
+	w.file.Close()
+	_ = os.Remove(w.file.Name())
+}
+
+// Extract extracts the bundle at path into dir and returns its manifest and registry snapshot.
+// The bundle is read with the limits of release archives.
+func Extract(path, dir string) (*Manifest, *registry.Registry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if format, err := extract.Detect(path, f, info.Size()); err != nil || format != extract.TarGz {
+		return nil, nil, errorutil.New("%s is not a crtm bundle", path)
+	}
+	err = extract.Walk(extract.TarGz, f, info.Size(), func(entry extract.Entry, data io.Reader) error {
+		return extract.WriteFile(dir, entry.Name, data, 0644)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, nil, errorutil.NewWithErr(err).Msgf("%s is not a crtm bundle", path)
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, nil, err
+	}
+	if manifest.Version > SchemaVersion {
+		return nil, nil, errorutil.NewWithTag("bundle", "bundle version %d is not supported (max %d), please update crtm", manifest.Version, SchemaVersion)
+	}
+	data, err = os.ReadFile(filepath.Join(dir, RegistryFile))
+	if err != nil {
+		return nil, nil, err
+	}
+	snapshot, err := registry.Parse(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return manifest, snapshot, nil
+}
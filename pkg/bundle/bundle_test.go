@@ -0,0 +1,79 @@
+package bundle
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/chainreactors/crtm/pkg/extract"
+	"github.com/chainreactors/crtm/pkg/lockfile"
+	"github.com/chainreactors/crtm/pkg/registry"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateExtract(t *testing.T) {
+	dir, err := os.MkdirTemp("", "test-bundle")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	bundlePath := filepath.Join(dir, "kit.tar.gz")
+	w, err := Create(bundlePath)
+	require.Nil(t, err)
+	tool := Tool{Name: "gogo", Version: "2.11.0", Assets: map[string]lockfile.Asset{
+		"linux/amd64": {Name: "gogo_linux_amd64", SHA256: "aaaa"},
+	}}
+	require.Nil(t, w.AddData(path.Join(tool.Dir(), "gogo_linux_amd64"), []byte("gogo")))
+	w.Manifest.Tools = append(w.Manifest.Tools, tool)
+	w.Registry.Merge(&registry.Registry{Tools: []registry.Entry{{Name: "gogo", Repo: "gogo", Org: "chainreactors"}}})
+	require.Nil(t, w.Close())
+
+	out := filepath.Join(dir, "out")
+	manifest, snapshot, err := Extract(bundlePath, out)
+	require.Nil(t, err)
+	require.Equal(t, SchemaVersion, manifest.Version)
+	require.Equal(t, tool, manifest.Tools[0])
+	entry, ok := snapshot.Get("gogo")
+	require.True(t, ok)
+	require.Equal(t, "chainreactors", entry.Org)
+
+	data, err := os.ReadFile(filepath.Join(out, "gogo", "2.11.0", "gogo_linux_amd64"))
+	require.Nil(t, err)
+	require.Equal(t, "gogo", string(data))
+}
+
+func TestExtractIllegalPath(t *testing.T) {
+	dir, err := os.MkdirTemp("", "test-bundle")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	bundlePath := filepath.Join(dir, "kit.tar.gz")
+	w, err := Create(bundlePath)
+	require.Nil(t, err)
+	require.Nil(t, w.AddData("../escape", []byte("x")))
+	require.Nil(t, w.Close())
+
+	_, _, err = Extract(bundlePath, filepath.Join(dir, "out"))
+	require.NotNil(t, err)
+	require.NoFileExists(t, filepath.Join(dir, "escape"))
+}
+
+func TestExtractLimits(t *testing.T) {
+	dir, err := os.MkdirTemp("", "test-bundle")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	bundlePath := filepath.Join(dir, "kit.tar.gz")
+	w, err := Create(bundlePath)
+	require.Nil(t, err)
+	require.Nil(t, w.AddData("gogo/2.11.0/gogo_linux_amd64", []byte("gogo")))
+	require.Nil(t, w.Close())
+
+	defer func(maxEntries int) { extract.MaxEntries = maxEntries }(extract.MaxEntries)
+	extract.MaxEntries = 2
+	_, _, err = Extract(bundlePath, filepath.Join(dir, "out"))
+	require.ErrorIs(t, err, extract.ErrTooManyEntries)
+
+	_, _, err = Extract(filepath.Join("..", "..", "README.md"), filepath.Join(dir, "out"))
+	require.ErrorContains(t, err, "is not a crtm bundle")
+}
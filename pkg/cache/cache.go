@@ -0,0 +1,302 @@
+// Package cache keeps downloaded release assets content-addressed by sha256
+// so that tools can be reinstalled without network access.
+//
+// Layout: <Root>/blobs/<sha256> with <Root>/index.json mapping repo/version/asset to blobs,
+// interrupted downloads are kept in <Root>/partial/ to be resumed.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chainreactors/crtm/pkg/state"
+)
+
+// Root is the directory holding the cache
+var Root = func() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".cache", "crtm")
+}()
+
+var mu sync.Mutex
+
+// Entry is a cached release asset
+type Entry struct {
+	Repo    string `json:"repo"`
+	Version string `json:"version"`
+	Asset   string `json:"asset"`
+	SHA256  string `json:"sha256"`
+	Size    int64  `json:"size"`
+	// Verified is set when the asset matched the release checksums when it was cached
+	Verified bool      `json:"verified,omitempty"`
+	AddedAt  time.Time `json:"added_at"`
+	UsedAt   time.Time `json:"used_at"`
+}
+
+// Index lists the cached assets
+type Index struct {
+	Entries []Entry `json:"entries"`
+}
+
+// BlobPath returns the path of the blob with given sha256
+func BlobPath(sum string) string {
+	return filepath.Join(Root, "blobs", strings.ToLower(sum))
+}
+
+func indexPath() string {
+	return filepath.Join(Root, "index.json")
+}
+
+func load() (*Index, error) {
+	index := &Index{}
+	data, err := os.ReadFile(indexPath())
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("%s: %w", indexPath(), err)
+	}
+	return index, nil
+}
+
+func (i *Index) save() error {
+	data, err := json.MarshalIndent(i, "", "  ")
+	if err != nil {
+		return err
+	}
+	return state.WriteFileAtomic(indexPath(), data, 0644)
+}
+
+func (i *Index) find(repo, version, asset string) int {
+	for n, entry := range i.Entries {
+		if entry.Repo == repo && entry.Version == version && entry.Asset == asset {
+			return n
+		}
+	}
+	return -1
+}
+
+// Open returns the cached blob of a release asset and marks it as used
+func Open(repo, version, asset string) (*os.File, Entry, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	index, err := load()
+	if err != nil {
+		return nil, Entry{}, false
+	}
+	n := index.find(repo, version, asset)
+	if n < 0 {
+		return nil, Entry{}, false
+	}
+	f, err := os.Open(BlobPath(index.Entries[n].SHA256))
+	if err != nil {
+		return nil, Entry{}, false
+	}
+	index.Entries[n].UsedAt = time.Now()
+	_ = index.save()
+	return f, index.Entries[n], true
+}
+
+// Create returns a temporary file in the cache, it is added with Commit or removed with Discard
+func Create() (*os.File, error) {
+	dir := filepath.Join(Root, "blobs")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(dir, ".download-*")
+}
+
+// stalePartial is the age after which an abandoned partial download is removed
+var stalePartial = 7 * 24 * time.Hour
+
+// Partial returns the file a release asset is downloaded to. It is kept across runs so that an
+// interrupted download resumes from its content, it is added with Commit or removed with Discard.
+func Partial(repo, version, asset string) (*os.File, error) {
+	dir := filepath.Join(Root, "partial")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	removeStalePartials(dir)
+	key := sha256.Sum256([]byte(repo + "/" + version + "/" + asset))
+	return os.OpenFile(filepath.Join(dir, hex.EncodeToString(key[:])), os.O_RDWR|os.O_CREATE, 0644)
+}
+
+func removeStalePartials(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && time.Since(info.ModTime()) > stalePartial {
+			_ = os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
+
+// Commit moves a temporary or partial file with given sha256 to the blobs and indexes it as the release asset,
+// verified records that the sha256 was checked against the release checksums
+func Commit(f *os.File, repo, version, asset, sum string, verified bool) error {
+	if err := f.Sync(); err != nil {
+		Discard(f)
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		Discard(f)
+		return err
+	}
+	f.Close()
+	sum = strings.ToLower(sum)
+	if err := os.MkdirAll(filepath.Dir(BlobPath(sum)), os.ModePerm); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), BlobPath(sum)); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	index, err := load()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	entry := Entry{Repo: repo, Version: version, Asset: asset, SHA256: sum, Size: info.Size(), Verified: verified, AddedAt: now, UsedAt: now}
+	if n := index.find(repo, version, asset); n >= 0 {
+		index.Entries[n] = entry
+	} else {
+		index.Entries = append(index.Entries, entry)
+	}
+	return index.save()
+}
+
+// Import copies the file at src with given sha256 to the cache as the release asset
+func Import(src, repo, version, asset, sum string, verified bool) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	f, err := Create()
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, in); err != nil {
+		Discard(f)
+		return err
+	}
+	return Commit(f, repo, version, asset, sum, verified)
+}
+
+// Evict removes a release asset from the cache, its blob is removed unless another asset shares it
+func Evict(repo, version, asset string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	index, err := load()
+	if err != nil {
+		return err
+	}
+	n := index.find(repo, version, asset)
+	if n < 0 {
+		return nil
+	}
+	sum := index.Entries[n].SHA256
+	index.Entries = append(index.Entries[:n], index.Entries[n+1:]...)
+	if err := index.save(); err != nil {
+		return err
+	}
+	for _, entry := range index.Entries {
+		if entry.SHA256 == sum {
+			return nil
+		}
+	}
+	if err := os.Remove(BlobPath(sum)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Discard removes a temporary or partial file
+func Discard(f *os.File) {
+	f.Close()
+	_ = os.Remove(f.Name())
+}
+
+// List returns the cached assets, most recently used first
+func List() ([]Entry, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	index, err := load()
+	if err != nil {
+		return nil, err
+	}
+	sortByUse(index.Entries)
+	return index.Entries, nil
+}
+
+// Size returns the total size of the cached blobs
+func Size(entries []Entry) int64 {
+	var size int64
+	seen := map[string]struct{}{}
+	for _, entry := range entries {
+		if _, ok := seen[entry.SHA256]; ok {
+			continue
+		}
+		seen[entry.SHA256] = struct{}{}
+		size += entry.Size
+	}
+	return size
+}
+
+// Prune removes the least recently used assets until the cache fits in maxSize bytes and returns them
+func Prune(maxSize int64) ([]Entry, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	index, err := load()
+	if err != nil {
+		return nil, err
+	}
+	sortByUse(index.Entries)
+	var kept, removed []Entry
+	for _, entry := range index.Entries {
+		if Size(append(kept, entry)) <= maxSize {
+			kept = append(kept, entry)
+		} else {
+			removed = append(removed, entry)
+		}
+	}
+	keptBlobs := map[string]struct{}{}
+	for _, entry := range kept {
+		keptBlobs[entry.SHA256] = struct{}{}
+	}
+	for _, entry := range removed {
+		if _, ok := keptBlobs[entry.SHA256]; ok {
+			continue
+		}
+		if err := os.Remove(BlobPath(entry.SHA256)); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	index.Entries = kept
+	return removed, index.save()
+}
+
+func sortByUse(entries []Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].UsedAt.After(entries[j].UsedAt)
+	})
+}
@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func add(t *testing.T, version, data, sum string) {
+	f, err := Create()
+	require.Nil(t, err)
+	_, err = f.WriteString(data)
+	require.Nil(t, err)
+	require.Nil(t, Commit(f, "chainreactors/gogo", version, "gogo_linux_amd64", sum, false))
+}
+
+func TestCache(t *testing.T) {
+	dir, err := os.MkdirTemp("", "test-cache")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	Root = dir
+
+	_, _, ok := Open("chainreactors/gogo", "1.0.0", "gogo_linux_amd64")
+	require.False(t, ok)
+
+	add(t, "1.0.0", "gogo 1.0.0", "AAAA")
+	time.Sleep(10 * time.Millisecond)
+	add(t, "1.1.0", "gogo 1.1.0", "bbbb")
+
+	f, entry, ok := Open("chainreactors/gogo", "1.0.0", "gogo_linux_amd64")
+	require.True(t, ok)
+	data, err := io.ReadAll(f)
+	f.Close()
+	require.Nil(t, err)
+	require.Equal(t, "gogo 1.0.0", string(data))
+	require.Equal(t, "aaaa", entry.SHA256)
+	require.False(t, entry.Verified)
+
+	entries, err := List()
+	require.Nil(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, "1.0.0", entries[0].Version)
+	require.Equal(t, int64(20), Size(entries))
+
+	removed, err := Prune(15)
+	require.Nil(t, err)
+	require.Len(t, removed, 1)
+	require.Equal(t, "1.1.0", removed[0].Version)
+	require.NoFileExists(t, BlobPath("bbbb"))
+	require.FileExists(t, BlobPath("aaaa"))
+
+	removed, err = Prune(0)
+	require.Nil(t, err)
+	require.Len(t, removed, 1)
+	entries, err = List()
+	require.Nil(t, err)
+	require.Empty(t, entries)
+}
+
+func TestPartial(t *testing.T) {
+	dir, err := os.MkdirTemp("", "test-cache")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	Root = dir
+
+	// a partial download is reopened with its content
+	f, err := Partial("chainreactors/gogo", "1.0.0", "gogo_linux_amd64")
+	require.Nil(t, err)
+	_, err = f.WriteString("gogo")
+	require.Nil(t, err)
+	f.Close()
+	f, err = Partial("chainreactors/gogo", "1.0.0", "gogo_linux_amd64")
+	require.Nil(t, err)
+	info, err := f.Stat()
+	require.Nil(t, err)
+	require.Equal(t, int64(4), info.Size())
+	_, err = f.Seek(0, io.SeekEnd)
+	require.Nil(t, err)
+	_, err = f.WriteString(" 1.0.0")
+	require.Nil(t, err)
+
+	require.Nil(t, Commit(f, "chainreactors/gogo", "1.0.0", "gogo_linux_amd64", "aaaa", true))
+	blob, entry, ok := Open("chainreactors/gogo", "1.0.0", "gogo_linux_amd64")
+	require.True(t, ok)
+	require.True(t, entry.Verified)
+	data, err := io.ReadAll(blob)
+	blob.Close()
+	require.Nil(t, err)
+	require.Equal(t, "gogo 1.0.0", string(data))
+	_, err = os.Stat(f.Name())
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestEvict(t *testing.T) {
+	dir, err := os.MkdirTemp("", "test-cache")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	Root = dir
+
+	add(t, "1.0.0", "gogo", "aaaa")
+	add(t, "1.1.0", "gogo", "aaaa")
+	add(t, "1.2.0", "gogo 1.2.0", "bbbb")
+
+	// a blob shared by another asset is kept
+	require.Nil(t, Evict("chainreactors/gogo", "1.0.0", "gogo_linux_amd64"))
+	_, _, ok := Open("chainreactors/gogo", "1.0.0", "gogo_linux_amd64")
+	require.False(t, ok)
+	require.FileExists(t, BlobPath("aaaa"))
+
+	require.Nil(t, Evict("chainreactors/gogo", "1.2.0", "gogo_linux_amd64"))
+	require.NoFileExists(t, BlobPath("bbbb"))
+	entries, err := List()
+	require.Nil(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "1.1.0", entries[0].Version)
+
+	require.Nil(t, Evict("chainreactors/gogo", "1.2.0", "gogo_linux_amd64"))
+}
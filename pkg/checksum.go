@@ -0,0 +1,175 @@
+package pkg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/chainreactors/crtm/pkg/provider"
+	"github.com/chainreactors/crtm/pkg/signature"
+	"github.com/chainreactors/crtm/pkg/types"
+	"github.com/chainreactors/crtm/pkg/update"
+	"github.com/chainreactors/crtm/pkg/utils"
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+// assetChecksum returns the expected sha256 of the asset, taken from the release checksums file
+// unless already known. An empty checksum is returned when the release doesn't publish one.
+func assetChecksum(tool types.Tool, assetName string) (string, error) {
+	if expected, ok := tool.Checksums[assetName]; ok {
+		return expected, nil
+	}
+	checksums, err := releaseChecksums(tool)
+	switch {
+	case errors.Is(err, signature.ErrUnsigned), errors.Is(err, signature.ErrBadSignature):
+		return "", err
+	case err != nil && !errors.Is(err, types.ErrNoChecksum):
+		return "", errorutil.NewWithErr(err).Msgf("failed to fetch checksums of %s", tool.Name)
+	}
+	if expected, ok := checksums[assetName]; ok {
+		return expected, nil
+	}
+	if err == nil {
+		// a signed checksums file not listing the asset leaves it as unverified as a missing signature
+		keys, err := pinnedKeys(tool)
+		if err != nil {
+			return "", err
+		}
+		if len(keys) > 0 {
+			return "", allowUnsigned(tool, fmt.Errorf("%s: %w", assetName, signature.ErrUnsigned))
+		}
+	}
+	if RequireChecksums {
+		return "", fmt.Errorf("%s: %w, refusing to install", assetName, types.ErrNoChecksum)
+	}
+	logger(tool).Warning().Msgf("%s: %s, skipping checksum verification", assetName, types.ErrNoChecksum)
+	return "", nil
+}
+
+// releaseChecksums returns the checksums of the release assets in map[asset_name]sha256 format
+func releaseChecksums(tool types.Tool) (map[string]string, error) {
+	_, data, err := releaseChecksumsFile(tool)
+	if err != nil {
+		return nil, err
+	}
+	return update.ParseChecksums(data)
+}
+
+// releaseChecksumsFile returns the name and content of the release checksums file, its signature
+// is verified when keys are pinned for the tool
+func releaseChecksumsFile(tool types.Tool) (string, []byte, error) {
+	var names []string
+	for name := range tool.Assets {
+		if strings.HasSuffix(name, "checksums.txt") {
+			names = append(names, name)
+		}
+	}
+	keys, err := pinnedKeys(tool)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(names) == 0 {
+		if len(keys) > 0 {
+			if err := allowUnsigned(tool, signature.ErrUnsigned); err != nil {
+				return "", nil, err
+			}
+		}
+		return "", nil, types.ErrNoChecksum
+	}
+	sort.Strings(names)
+	name := names[0]
+	// prefer the checksums file following the goreleaser naming
+	for _, candidate := range names {
+		if candidate == fmt.Sprintf("%s_%s_checksums.txt", tool.Name, tool.Version) {
+			name = candidate
+		}
+	}
+	data, err := readAsset(tool, name)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(keys) > 0 {
+		if err := verifySignature(tool, name, data, keys); err != nil {
+			return "", nil, err
+		}
+	}
+	return name, data, nil
+}
+
+// pinnedKeys returns the keys the release checksums of the tool must be signed with
+func pinnedKeys(tool types.Tool) ([]signature.Key, error) {
+	keys, err := signature.ParseKeys(tool.PublicKeys)
+	if err != nil {
+		return nil, err
+	}
+	return append(keys, signature.Trusted...), nil
+}
+
+// verifySignature verifies the detached signature of a release file published as <name>.minisig
+func verifySignature(tool types.Tool, name string, data []byte, keys []signature.Key) error {
+	signatureName := name + signature.Ext
+	if !hasAsset(tool, signatureName) {
+		return allowUnsigned(tool, fmt.Errorf("%s: %w", name, signature.ErrUnsigned))
+	}
+	sig, err := readAsset(tool, signatureName)
+	if err != nil {
+		return err
+	}
+	if err := signature.Verify(keys, data, sig); err != nil {
+		return allowUnsigned(tool, fmt.Errorf("%s: %w", name, err))
+	}
+	logger(tool).Verbose().Msgf("verified signature of %s", name)
+	return nil
+}
+
+// allowUnsigned returns the signature error unless unsigned releases are allowed
+func allowUnsigned(tool types.Tool, err error) error {
+	if !signature.AllowUnsigned {
+		return fmt.Errorf("%s %s: %w", tool.Name, tool.Version, err)
+	}
+	logger(tool).Warning().Msgf("%s %s: %s, installing anyway", tool.Name, tool.Version, err)
+	return nil
+}
+
+// hashAsset downloads a release asset and returns its sha256
+func hashAsset(tool types.Tool, assetName string) (string, error) {
+	body, err := openAsset(tool, assetName)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// hasAsset reports whether the release of the tool has an asset of given name
+func hasAsset(tool types.Tool, assetName string) bool {
+	_, ok := tool.Assets[assetName]
+	return ok
+}
+
+// readAsset downloads a small release file such as a checksums file or signature
+func readAsset(tool types.Tool, assetName string) ([]byte, error) {
+	body, err := openAsset(tool, assetName)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+func openAsset(tool types.Tool, assetName string) (io.ReadCloser, error) {
+	p, err := utils.GetProvider(tool)
+	if err != nil {
+		return nil, err
+	}
+	return p.OpenAsset(context.Background(), tool.GetOrg(), tool.Repo, provider.Asset{ID: tool.Assets[assetName], Name: assetName, URL: tool.AssetURLs[assetName]})
+}
@@ -0,0 +1,192 @@
+package pkg
+
+import (
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"aead.dev/minisign"
+	"github.com/chainreactors/crtm/pkg/bundle"
+	"github.com/chainreactors/crtm/pkg/signature"
+	"github.com/chainreactors/crtm/pkg/types"
+	"github.com/chainreactors/crtm/pkg/update"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssetChecksum(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("aaaa  gogo_1.0.0_linux_amd64.tar.gz\nbbbb  gogo_1.0.0_windows_amd64.zip\n"))
+	}))
+	defer ts.Close()
+
+	tool := types.Tool{
+		Name:        "gogo",
+		Version:     "1.0.0",
+		Provider:    "http",
+		ProviderURL: ts.URL,
+		Assets: map[string]int64{
+			"gogo_1.0.0_checksums.txt":       1,
+			"gogo_1.0.0_linux_amd64.tar.gz":  2,
+			"gogo_1.0.0_darwin_amd64.tar.gz": 3,
+		},
+		AssetURLs: map[string]string{"gogo_1.0.0_checksums.txt": ts.URL + "/gogo_1.0.0_checksums.txt"},
+	}
+	expected, err := assetChecksum(tool, "gogo_1.0.0_linux_amd64.tar.gz")
+	require.Nil(t, err)
+	require.Equal(t, "aaaa", expected)
+
+	expected, err = assetChecksum(tool, "gogo_1.0.0_darwin_amd64.tar.gz")
+	require.Nil(t, err)
+	require.Empty(t, expected)
+
+	RequireChecksums = true
+	defer func() { RequireChecksums = false }()
+	_, err = assetChecksum(tool, "gogo_1.0.0_darwin_amd64.tar.gz")
+	require.True(t, errors.Is(err, types.ErrNoChecksum))
+
+	tool.Checksums = map[string]string{"gogo_1.0.0_darwin_amd64.tar.gz": "cccc"}
+	expected, err = assetChecksum(tool, "gogo_1.0.0_darwin_amd64.tar.gz")
+	require.Nil(t, err)
+	require.Equal(t, "cccc", expected)
+}
+
+func TestSignedChecksums(t *testing.T) {
+	public, private, err := minisign.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	checksums := []byte("aaaa  gogo_1.0.0_linux_amd64.tar.gz\n")
+	sig := minisign.Sign(private, checksums)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, signature.Ext) {
+			_, _ = w.Write(sig)
+			return
+		}
+		_, _ = w.Write(checksums)
+	}))
+	defer ts.Close()
+
+	tool := types.Tool{
+		Name:        "gogo",
+		Version:     "1.0.0",
+		Provider:    "http",
+		ProviderURL: ts.URL,
+		PublicKeys:  []string{public.String()},
+		Assets:      map[string]int64{"gogo_1.0.0_checksums.txt": 1, "gogo_1.0.0_linux_amd64.tar.gz": 2},
+		AssetURLs: map[string]string{
+			"gogo_1.0.0_checksums.txt":         ts.URL + "/gogo_1.0.0_checksums.txt",
+			"gogo_1.0.0_checksums.txt.minisig": ts.URL + "/gogo_1.0.0_checksums.txt.minisig",
+		},
+	}
+	// signature asset missing from the release
+	_, err = assetChecksum(tool, "gogo_1.0.0_linux_amd64.tar.gz")
+	require.ErrorIs(t, err, signature.ErrUnsigned)
+
+	signature.AllowUnsigned = true
+	expected, err := assetChecksum(tool, "gogo_1.0.0_linux_amd64.tar.gz")
+	signature.AllowUnsigned = false
+	require.Nil(t, err)
+	require.Equal(t, "aaaa", expected)
+
+	tool.Assets["gogo_1.0.0_checksums.txt.minisig"] = 3
+	expected, err = assetChecksum(tool, "gogo_1.0.0_linux_amd64.tar.gz")
+	require.Nil(t, err)
+	require.Equal(t, "aaaa", expected)
+
+	// signed checksums file not listing the asset
+	tool.Assets["gogo_1.0.0_darwin_amd64.tar.gz"] = 4
+	_, err = assetChecksum(tool, "gogo_1.0.0_darwin_amd64.tar.gz")
+	require.ErrorIs(t, err, signature.ErrUnsigned)
+
+	signature.AllowUnsigned = true
+	expected, err = assetChecksum(tool, "gogo_1.0.0_darwin_amd64.tar.gz")
+	signature.AllowUnsigned = false
+	require.Nil(t, err)
+	require.Empty(t, expected)
+
+	otherPublic, _, err := minisign.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	tool.PublicKeys = []string{otherPublic.String()}
+	_, err = assetChecksum(tool, "gogo_1.0.0_linux_amd64.tar.gz")
+	require.ErrorIs(t, err, signature.ErrBadSignature)
+}
+
+func TestVerifyBundleSignature(t *testing.T) {
+	dir, err := os.MkdirTemp("", "test-bundle")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	public, private, err := minisign.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	data := []byte("aaaa  gogo_1.0.0_linux_amd64.tar.gz\n")
+	checksums, err := update.ParseChecksums(data)
+	require.Nil(t, err)
+	bundled := bundle.Tool{Name: "gogo", Version: "1.0.0", Checksums: "gogo_1.0.0_checksums.txt"}
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "gogo", "1.0.0"), os.ModePerm))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "gogo", "1.0.0", "gogo_1.0.0_checksums.txt.minisig"), minisign.Sign(private, data), 0644))
+
+	tool := types.Tool{Name: "gogo", Version: "1.0.0"}
+	require.Nil(t, verifyBundleSignature(tool, dir, bundled, data, checksums, "gogo_1.0.0_linux_amd64.tar.gz"))
+
+	// the signature isn't bundled
+	tool.PublicKeys = []string{public.String()}
+	err = verifyBundleSignature(tool, dir, bundled, data, checksums, "gogo_1.0.0_linux_amd64.tar.gz")
+	require.ErrorIs(t, err, signature.ErrUnsigned)
+
+	bundled.Signature = "gogo_1.0.0_checksums.txt.minisig"
+	require.Nil(t, verifyBundleSignature(tool, dir, bundled, data, checksums, "gogo_1.0.0_linux_amd64.tar.gz"))
+
+	err = verifyBundleSignature(tool, dir, bundled, data, checksums, "gogo_1.0.0_darwin_amd64.tar.gz")
+	require.ErrorIs(t, err, signature.ErrUnsigned)
+
+	tampered := []byte("bbbb  gogo_1.0.0_linux_amd64.tar.gz\n")
+	err = verifyBundleSignature(tool, dir, bundled, tampered, checksums, "gogo_1.0.0_linux_amd64.tar.gz")
+	require.ErrorIs(t, err, signature.ErrBadSignature)
+}
+
+func TestLockSignature(t *testing.T) {
+	_, private, err := minisign.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	otherPublic, _, err := minisign.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	checksums := []byte("aaaa  gogo_1.0.0_linux_amd64.tar.gz\n")
+	sig := minisign.Sign(private, checksums)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, signature.Ext) {
+			_, _ = w.Write(sig)
+			return
+		}
+		_, _ = w.Write(checksums)
+	}))
+	defer ts.Close()
+
+	tool := types.Tool{
+		Name:        "gogo",
+		Version:     "1.0.0",
+		Provider:    "http",
+		ProviderURL: ts.URL,
+		PublicKeys:  []string{otherPublic.String()},
+		Assets: map[string]int64{
+			"gogo_1.0.0_checksums.txt":         1,
+			"gogo_1.0.0_checksums.txt.minisig": 2,
+			"gogo_1.0.0_linux_amd64.tar.gz":    3,
+		},
+		AssetURLs: map[string]string{
+			"gogo_1.0.0_checksums.txt":         ts.URL + "/gogo_1.0.0_checksums.txt",
+			"gogo_1.0.0_checksums.txt.minisig": ts.URL + "/gogo_1.0.0_checksums.txt.minisig",
+		},
+	}
+	// a badly signed release isn't locked with the hashes of its assets
+	_, err = Lock(tool)
+	require.ErrorIs(t, err, signature.ErrBadSignature)
+
+	tool.PublicKeys = nil
+	entry, err := Lock(tool)
+	require.Nil(t, err)
+	require.Equal(t, "aaaa", entry.Assets["linux/amd64"].SHA256)
+}
@@ -115,3 +115,18 @@ func TestUpdateToolWithoutAssets(t *testing.T) {
 	_, exists := ospath.GetExecutablePath(pathBin, tool.Name)
 	require.True(t, exists)
 }
+
+func TestInstallOutsideConstraint(t *testing.T) {
+	tool := GetToolStruct()
+	tool.Constraint = ">=2"
+	tool.OutsideConstraint = true
+
+	pathBin, err := os.MkdirTemp("", "test-dir")
+	require.Nil(t, err)
+	defer os.RemoveAll(pathBin)
+
+	err = Install(pathBin, tool)
+	require.ErrorIs(t, err, types.ErrOutsideConstraint)
+	_, exists := ospath.GetExecutablePath(pathBin, tool.Name)
+	require.False(t, exists)
+}
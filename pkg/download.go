@@ -0,0 +1,235 @@
+package pkg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/chainreactors/crtm/pkg/provider"
+	"github.com/chainreactors/crtm/pkg/types"
+)
+
+var (
+	// DownloadSegments is the number of parallel range requests large assets are downloaded with
+	DownloadSegments = 1
+	// RequireChecksums refuses to install assets without a checksum in the release checksums file
+	RequireChecksums = false
+	// minSegmentSize is the smallest part of an asset fetched by a segment
+	minSegmentSize int64 = 4 << 20
+)
+
+// downloadAsset downloads asset to f and returns the sha256 and size of its content. With resume the data
+// already in f is kept and only the rest is requested when the provider serves ranges. On error f holds
+// the data downloaded so far, verified by the caller before it is used.
+func downloadAsset(tool types.Tool, p provider.Provider, asset provider.Asset, f *os.File, resume bool) (string, int64, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	requester, ok := p.(provider.AssetRequester)
+	if !ok {
+		return downloadWhole(ctx, tool, p, asset, f)
+	}
+	req, err := requester.AssetRequest(ctx, tool.GetOrg(), tool.Repo, asset)
+	if errors.Is(err, provider.ErrRangeNotSupported) {
+		return downloadWhole(ctx, tool, p, asset, f)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	var offset int64
+	if resume {
+		info, err := f.Stat()
+		if err != nil {
+			return "", 0, err
+		}
+		offset = info.Size()
+	}
+	body, err := provider.OpenRange(req, offset, -1)
+	if errors.Is(err, provider.ErrRangeNotSatisfiable) && offset > 0 {
+		// the previous run was interrupted once the whole asset was written
+		return hashFile(f)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	defer body.Close()
+	if body.Start != offset {
+		// the server ignored the range, the asset is downloaded again
+		offset = body.Start
+	}
+	if err := f.Truncate(offset); err != nil {
+		return "", 0, err
+	}
+	if offset > 0 {
+		logger(tool).Info().Msgf("resuming download of %s at %d bytes", asset.Name, offset)
+	}
+
+	if segments := segmentCount(body, offset); segments > 1 {
+		logger(tool).Verbose().Msgf("downloading %s in %d segments", asset.Name, segments)
+		if err := downloadSegments(ctx, req, f, body, offset, segments); err != nil {
+			return "", 0, err
+		}
+		return hashFile(f)
+	}
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, io.NewSectionReader(f, 0, offset)); err != nil {
+		return "", 0, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return "", 0, err
+	}
+	n, err := io.Copy(io.MultiWriter(f, hasher), body)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), offset + n, nil
+}
+
+// downloadWhole downloads asset to f from its start
+func downloadWhole(ctx context.Context, tool types.Tool, p provider.Provider, asset provider.Asset, f *os.File) (string, int64, error) {
+	body, err := p.OpenAsset(ctx, tool.GetOrg(), tool.Repo, asset)
+	if err != nil {
+		return "", 0, err
+	}
+	defer body.Close()
+	if err := f.Truncate(0); err != nil {
+		return "", 0, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", 0, err
+	}
+	hasher := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, hasher), body)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), n, nil
+}
+
+// segmentCount returns the number of segments the rest of the content from offset is split in,
+// segments need a server honoring ranges and a known size
+func segmentCount(body *provider.RangeBody, offset int64) int {
+	if DownloadSegments <= 1 || !body.Partial || body.Size <= 0 {
+		return 1
+	}
+	segments := (body.Size - offset) / minSegmentSize
+	if segments > int64(DownloadSegments) {
+		segments = int64(DownloadSegments)
+	}
+	if segments < 1 {
+		return 1
+	}
+	return int(segments)
+}
+
+// downloadSegments writes the content from offset to the end to f with parallel range requests. The first
+// segment is read from body and appended to f, the others are written to files next to it appended in order
+// once complete, so that f only ever holds data downloaded contiguously from its start and can be resumed
+// even after a crash.
+func downloadSegments(ctx context.Context, req *http.Request, f *os.File, body *provider.RangeBody, offset int64, segments int) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// the first segment stops when another one fails
+	go func() {
+		<-ctx.Done()
+		body.Close()
+	}()
+
+	var firstErr error
+	var once sync.Once
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+	size := (body.Size - offset) / int64(segments)
+	parts := make([]*os.File, segments)
+	complete := make([]bool, segments)
+	defer func() {
+		for _, part := range parts[1:] {
+			if part != nil {
+				part.Close()
+				_ = os.Remove(part.Name())
+			}
+		}
+	}()
+	wg := &sync.WaitGroup{}
+	for i := 0; i < segments; i++ {
+		start := offset + int64(i)*size
+		end := start + size - 1
+		if i == segments-1 {
+			end = body.Size - 1
+		}
+		var dst io.Writer = io.NewOffsetWriter(f, start)
+		if i > 0 {
+			part, err := os.Create(fmt.Sprintf("%s.%d", f.Name(), i))
+			if err != nil {
+				fail(err)
+				break
+			}
+			parts[i] = part
+			dst = part
+		}
+		wg.Add(1)
+		go func(i int, start, end int64, dst io.Writer) {
+			defer wg.Done()
+			var segment io.Reader = body
+			if i > 0 {
+				part, err := provider.OpenRange(req.WithContext(ctx), start, end)
+				if err == nil && (!part.Partial || part.Start != start) {
+					part.Close()
+					err = fmt.Errorf("got bytes from %d instead of %d", part.Start, start)
+				}
+				if err != nil {
+					fail(err)
+					return
+				}
+				defer part.Close()
+				segment = part
+			}
+			n, err := io.Copy(dst, io.LimitReader(segment, end-start+1))
+			if err == nil && n != end-start+1 {
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				fail(err)
+				return
+			}
+			complete[i] = true
+		}(i, start, end, dst)
+	}
+	wg.Wait()
+
+	// the segments following the data of f are appended, up to the first incomplete one
+	for i := 1; i < segments && complete[i-1] && complete[i]; i++ {
+		if _, err := parts[i].Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.Copy(io.NewOffsetWriter(f, offset+int64(i)*size), parts[i]); err != nil {
+			return err
+		}
+	}
+	return firstErr
+}
+
+// hashFile returns the sha256 and size of the content of f
+func hashFile(f *os.File) (string, int64, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", 0, err
+	}
+	hasher := sha256.New()
+	n, err := io.Copy(hasher, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), n, nil
+}
@@ -0,0 +1,141 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chainreactors/crtm/pkg/cache"
+	"github.com/chainreactors/crtm/pkg/provider"
+	"github.com/chainreactors/crtm/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadAsset(t *testing.T) {
+	content := strings.Repeat("crtm download ", 1<<14)
+	sum := sha256.Sum256([]byte(content))
+	var mu sync.Mutex
+	var ranges []string
+	var failFrom atomic.Int64
+	failFrom.Store(-1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rangeHeader := r.Header.Get("Range")
+		mu.Lock()
+		ranges = append(ranges, rangeHeader)
+		mu.Unlock()
+		if from := failFrom.Load(); from >= 0 && strings.HasPrefix(rangeHeader, "bytes="+strconv.FormatInt(from, 10)+"-") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		http.ServeContent(w, r, "asset", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	p, err := provider.New(provider.HTTP, server.URL)
+	require.Nil(t, err)
+	tool := types.Tool{Name: "gogo", Repo: "gogo"}
+	asset := provider.Asset{Name: "gogo_linux_amd64", URL: server.URL + "/gogo_linux_amd64"}
+	f, err := os.Create(filepath.Join(t.TempDir(), "partial"))
+	require.Nil(t, err)
+	defer f.Close()
+
+	// the download resumes after the data already downloaded
+	_, err = f.Write([]byte(content[:1000]))
+	require.Nil(t, err)
+	got, size, err := downloadAsset(tool, p, asset, f, true)
+	require.Nil(t, err)
+	require.Equal(t, hex.EncodeToString(sum[:]), got)
+	require.Equal(t, int64(len(content)), size)
+	require.Equal(t, []string{"bytes=1000-"}, ranges)
+
+	// large assets are downloaded in segments
+	defer func(segments int, segmentSize int64) {
+		DownloadSegments, minSegmentSize = segments, segmentSize
+	}(DownloadSegments, minSegmentSize)
+	DownloadSegments, minSegmentSize = 4, 1<<10
+	ranges = nil
+	got, _, err = downloadAsset(tool, p, asset, f, false)
+	require.Nil(t, err)
+	require.Equal(t, hex.EncodeToString(sum[:]), got)
+	require.Len(t, ranges, 4)
+
+	// a failed segment keeps the data downloaded contiguously
+	failFrom.Store(int64(len(content) / 2))
+	_, _, err = downloadAsset(tool, p, asset, f, false)
+	require.NotNil(t, err)
+	data, err := os.ReadFile(f.Name())
+	require.Nil(t, err)
+	require.True(t, len(data) <= len(content)/2)
+	require.True(t, strings.HasPrefix(content, string(data)))
+}
+
+func TestOpenInstallAssetFromCache(t *testing.T) {
+	defer func(root string) { cache.Root = root }(cache.Root)
+	cache.Root = t.TempDir()
+	content := "gogo 1.0.0"
+	sum := sha256.Sum256([]byte(content))
+	checksum := hex.EncodeToString(sum[:])
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "checksums.txt") {
+			_, _ = w.Write([]byte(checksum + "  gogo_1.0.0_linux_amd64\n"))
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+	defer server.Close()
+	tool := types.Tool{
+		Name:        "gogo",
+		Repo:        "gogo",
+		Version:     "1.0.0",
+		Provider:    "http",
+		ProviderURL: server.URL,
+		Assets:      map[string]int64{"gogo_1.0.0_checksums.txt": 1, "gogo_1.0.0_linux_amd64": 2},
+		AssetURLs: map[string]string{
+			"gogo_1.0.0_checksums.txt": server.URL + "/gogo_1.0.0_checksums.txt",
+			"gogo_1.0.0_linux_amd64":   server.URL + "/gogo_1.0.0_linux_amd64",
+		},
+	}
+	cacheAsset := func(data, sum string, verified bool) {
+		f, err := cache.Create()
+		require.Nil(t, err)
+		_, err = f.WriteString(data)
+		require.Nil(t, err)
+		require.Nil(t, cache.Commit(f, tool.RepoPath(), "1.0.0", "gogo_1.0.0_linux_amd64", sum, verified))
+	}
+	open := func() *installAsset {
+		asset, err := openInstallAsset(tool, "gogo_1.0.0_linux_amd64", 2)
+		require.Nil(t, err)
+		require.Equal(t, checksum, asset.sha256)
+		return asset
+	}
+
+	// a corrupt blob is evicted and downloaded again
+	cacheAsset("corrupt", checksum, true)
+	asset := open()
+	require.True(t, asset.download)
+	require.True(t, asset.verified)
+	asset.keep(tool, "gogo_1.0.0_linux_amd64")
+
+	// a verified blob is used as is
+	asset = open()
+	require.False(t, asset.download)
+	asset.discard()
+
+	// a blob cached without verification is checked against the release checksums
+	other := sha256.Sum256([]byte("other"))
+	cacheAsset("other", hex.EncodeToString(other[:]), false)
+	asset = open()
+	require.True(t, asset.download)
+	asset.discard()
+	_, _, ok := cache.Open(tool.RepoPath(), "1.0.0", "gogo_1.0.0_linux_amd64")
+	require.False(t, ok)
+}
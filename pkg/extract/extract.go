@@ -0,0 +1,267 @@
+// Package extract reads release archives. It only hands out regular files whose path stays inside the
+// archive, rejects links and special files, and stops archives extracting to more data or entries than
+// allowed, so that a hostile asset can't write outside its destination or fill the disk.
+package extract
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Format is the format of a release asset
+type Format uint
+
+const (
+	Zip Format = iota
+	TarGz
+	TarXz
+	TarBz2
+	TarZst
+	Tar
+	// Gz, Xz, Bz2 and Zst are a single compressed file
+	Gz
+	Xz
+	Bz2
+	Zst
+	// Binary is an uncompressed executable
+	Binary
+)
+
+var (
+	// MaxSize is the largest total size of the files of an archive
+	MaxSize int64 = 2 << 30
+	// MaxEntries is the largest number of entries of an archive
+	MaxEntries = 10000
+)
+
+var (
+	// ErrPathTraversal is returned for entries with an absolute path or a path escaping the archive
+	ErrPathTraversal = errors.New("path escapes the destination")
+	// ErrLink is returned for symlink and hardlink entries
+	ErrLink = errors.New("links are not allowed")
+	// ErrSpecialFile is returned for device, fifo and other non regular entries
+	ErrSpecialFile = errors.New("special files are not allowed")
+	// ErrTooLarge is returned when the files of an archive exceed MaxSize
+	ErrTooLarge = errors.New("archive exceeds the size limit")
+	// ErrTooManyEntries is returned when an archive has more than MaxEntries entries
+	ErrTooManyEntries = errors.New("archive exceeds the entry limit")
+)
+
+// EntryError is the error of an archive entry
+type EntryError struct {
+	Entry string
+	Err   error
+}
+
+func (e *EntryError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Entry, e.Err)
+}
+
+func (e *EntryError) Unwrap() error {
+	return e.Err
+}
+
+// Entry is a regular file of an archive
+type Entry struct {
+	// Name is the cleaned slash separated path of the file in the archive
+	Name string
+	Info fs.FileInfo
+}
+
+// WalkFunc is called with every regular file of an archive, returning an error stops the walk
+type WalkFunc func(entry Entry, data io.Reader) error
+
+// Walk calls fn with the regular files of the archive of given format and size in r, directories
+// are skipped and any other kind of entry stops the walk with an EntryError
+func Walk(format Format, r io.ReaderAt, size int64, fn WalkFunc) error {
+	switch {
+	case format == Zip:
+		return walkZip(r, size, fn)
+	case format.IsArchive():
+		data, err := decompress(format.compression(), io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return err
+		}
+		defer data.Close()
+		return walkTar(data, fn)
+	default:
+		return fmt.Errorf("%s is not an archive", format)
+	}
+}
+
+// WriteFile writes data to the file at the slash separated name under dir
+func WriteFile(dir, name string, data io.Reader, perm fs.FileMode) error {
+	name, err := cleanName(name)
+	if err != nil {
+		return &EntryError{Entry: name, Err: err}
+	}
+	filePath := filepath.Join(dir, filepath.FromSlash(name))
+	if !strings.HasPrefix(filePath, filepath.Clean(dir)+string(os.PathSeparator)) {
+		return &EntryError{Entry: name, Err: ErrPathTraversal}
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		return err
+	}
+	// an existing file is replaced rather than written through, it could be a link planted by an earlier entry
+	_ = os.Remove(filePath)
+	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(filePath, perm)
+}
+
+func walkZip(r io.ReaderAt, size int64, fn WalkFunc) error {
+	zipReader, err := zip.NewReader(r, size)
+	if errors.Is(err, zip.ErrInsecurePath) {
+		// the paths are checked entry by entry below
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(zipReader.File) > MaxEntries {
+		return ErrTooManyEntries
+	}
+	limit := &limiter{}
+	for _, f := range zipReader.File {
+		name, err := checkEntry(f.Name, f.Mode())
+		if err != nil {
+			return err
+		}
+		if f.Mode().IsDir() {
+			continue
+		}
+		if err := limit.add(f.Name, int64(f.UncompressedSize64)); err != nil {
+			return err
+		}
+		data, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = fn(Entry{Name: name, Info: f.FileInfo()}, limit.reader(f.Name, data))
+		data.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkTar(r io.Reader, fn WalkFunc) error {
+	tarReader := tar.NewReader(r)
+	limit := &limiter{}
+	for entries := 1; ; entries++ {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if errors.Is(err, tar.ErrInsecurePath) {
+			return &EntryError{Entry: header.Name, Err: ErrPathTraversal}
+		}
+		if err != nil {
+			return err
+		}
+		if entries > MaxEntries {
+			return ErrTooManyEntries
+		}
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		if header.Typeflag == tar.TypeLink {
+			return &EntryError{Entry: header.Name, Err: ErrLink}
+		}
+		mode := header.FileInfo().Mode()
+		name, err := checkEntry(header.Name, mode)
+		if err != nil {
+			return err
+		}
+		if mode.IsDir() {
+			continue
+		}
+		if err := limit.add(header.Name, header.Size); err != nil {
+			return err
+		}
+		if err := fn(Entry{Name: name, Info: header.FileInfo()}, limit.reader(header.Name, tarReader)); err != nil {
+			return err
+		}
+	}
+}
+
+// checkEntry returns the cleaned name of an entry that is a regular file or a directory
+func checkEntry(name string, mode fs.FileMode) (string, error) {
+	cleaned, err := cleanName(name)
+	if err != nil {
+		return "", &EntryError{Entry: name, Err: err}
+	}
+	switch {
+	case mode&fs.ModeSymlink != 0:
+		return "", &EntryError{Entry: name, Err: ErrLink}
+	case !mode.IsDir() && !mode.IsRegular():
+		return "", &EntryError{Entry: name, Err: ErrSpecialFile}
+	}
+	return cleaned, nil
+}
+
+// cleanName returns the cleaned slash separated form of an entry name, names are rejected when absolute,
+// with a drive or stream separator or escaping the archive on any platform
+func cleanName(name string) (string, error) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if name == "" || strings.HasPrefix(name, "/") || strings.Contains(name, ":") {
+		return name, ErrPathTraversal
+	}
+	cleaned := path.Clean(name)
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return name, ErrPathTraversal
+	}
+	return cleaned, nil
+}
+
+// limiter accounts the size of the files of an archive against MaxSize, both as declared by the
+// entries and as actually read
+type limiter struct {
+	declared int64
+	read     int64
+}
+
+func (l *limiter) add(name string, size int64) error {
+	if size < 0 || l.declared+size > MaxSize {
+		return &EntryError{Entry: name, Err: ErrTooLarge}
+	}
+	l.declared += size
+	return nil
+}
+
+func (l *limiter) reader(name string, r io.Reader) io.Reader {
+	return &limitedReader{limiter: l, name: name, r: r}
+}
+
+type limitedReader struct {
+	*limiter
+	name string
+	r    io.Reader
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.read += int64(n)
+	if r.read > MaxSize {
+		return n, &EntryError{Entry: r.name, Err: ErrTooLarge}
+	}
+	return n, err
+}
@@ -0,0 +1,196 @@
+package extract
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// file is an entry of a test archive
+type file struct {
+	name     string
+	body     string
+	typeflag byte
+	mode     fs.FileMode
+	link     string
+}
+
+func reg(name, body string) file {
+	return file{name: name, body: body, typeflag: tar.TypeReg}
+}
+
+func tarGz(t testing.TB, files ...file) []byte {
+	buf := &bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, f := range files {
+		size := int64(len(f.body))
+		if f.typeflag != tar.TypeReg {
+			size = 0
+		}
+		header := &tar.Header{Name: f.name, Typeflag: f.typeflag, Mode: 0755, Size: size, Linkname: f.link, Format: tar.FormatPAX}
+		require.Nil(t, tarWriter.WriteHeader(header))
+		if size > 0 {
+			_, err := tarWriter.Write([]byte(f.body))
+			require.Nil(t, err)
+		}
+	}
+	require.Nil(t, tarWriter.Close())
+	require.Nil(t, gzipWriter.Close())
+	return buf.Bytes()
+}
+
+func zipArchive(t testing.TB, files ...file) []byte {
+	buf := &bytes.Buffer{}
+	zipWriter := zip.NewWriter(buf)
+	for _, f := range files {
+		header := &zip.FileHeader{Name: f.name, Method: zip.Deflate}
+		mode := f.mode
+		if mode == 0 {
+			mode = 0755
+		}
+		header.SetMode(mode)
+		w, err := zipWriter.CreateHeader(header)
+		require.Nil(t, err)
+		_, err = w.Write([]byte(f.body))
+		require.Nil(t, err)
+	}
+	require.Nil(t, zipWriter.Close())
+	return buf.Bytes()
+}
+
+// walk returns the entries of an archive and the error of the walk
+func walk(format Format, data []byte) (map[string]string, error) {
+	entries := map[string]string{}
+	err := Walk(format, bytes.NewReader(data), int64(len(data)), func(entry Entry, r io.Reader) error {
+		body, err := io.ReadAll(r)
+		entries[entry.Name] = string(body)
+		return err
+	})
+	return entries, err
+}
+
+func TestWalk(t *testing.T) {
+	files := []file{{name: "gogo_2.11.0/", typeflag: tar.TypeDir}, reg("gogo_2.11.0/gogo", "binary"), reg("./README.md", "readme")}
+	for format, data := range map[Format][]byte{TarGz: tarGz(t, files...), Zip: zipArchive(t, files...)} {
+		entries, err := walk(format, data)
+		require.Nil(t, err)
+		require.Equal(t, map[string]string{"gogo_2.11.0/gogo": "binary", "README.md": "readme"}, entries)
+	}
+}
+
+func TestHostileArchives(t *testing.T) {
+	defer func(size int64, entries int) { MaxSize, MaxEntries = size, entries }(MaxSize, MaxEntries)
+	MaxSize, MaxEntries = 1<<20, 16
+
+	many := make([]file, 0, 17)
+	for i := 0; i < 17; i++ {
+		many = append(many, reg(strings.Repeat("a", i+1), "x"))
+	}
+	bomb := reg("bomb", strings.Repeat("\x00", 2<<20))
+
+	tests := []struct {
+		name  string
+		files []file
+		want  error
+		// tarOnly entries can't be represented in a zip archive
+		tarOnly bool
+	}{
+		{name: "parent traversal", files: []file{reg("../evil", "x")}, want: ErrPathTraversal},
+		{name: "nested traversal", files: []file{reg("bin/../../evil", "x")}, want: ErrPathTraversal},
+		{name: "absolute path", files: []file{reg("/etc/evil", "x")}, want: ErrPathTraversal},
+		{name: "backslash traversal", files: []file{reg(`..\evil`, "x")}, want: ErrPathTraversal},
+		{name: "drive letter", files: []file{reg(`C:\Windows\evil`, "x")}, want: ErrPathTraversal},
+		{name: "unc path", files: []file{reg(`\\server\share\evil`, "x")}, want: ErrPathTraversal},
+		{name: "traversal directory", files: []file{{name: "../dir/", typeflag: tar.TypeDir}}, want: ErrPathTraversal, tarOnly: true},
+		{name: "symlink", files: []file{{name: "gogo", typeflag: tar.TypeSymlink, link: "/etc/passwd", mode: fs.ModeSymlink | 0777}}, want: ErrLink},
+		{name: "symlink then write through it", files: []file{{name: "dir", typeflag: tar.TypeSymlink, link: "/tmp", mode: fs.ModeSymlink | 0777}, reg("dir/evil", "x")}, want: ErrLink},
+		{name: "hardlink", files: []file{{name: "gogo", typeflag: tar.TypeLink, link: "/etc/passwd"}}, want: ErrLink, tarOnly: true},
+		{name: "fifo", files: []file{{name: "fifo", typeflag: tar.TypeFifo}}, want: ErrSpecialFile, tarOnly: true},
+		{name: "device", files: []file{{name: "null", typeflag: tar.TypeChar}}, want: ErrSpecialFile, tarOnly: true},
+		{name: "device mode", files: []file{{name: "null", typeflag: tar.TypeChar, mode: fs.ModeDevice | fs.ModeCharDevice | 0666}}, want: ErrSpecialFile},
+		{name: "decompression bomb", files: []file{bomb}, want: ErrTooLarge},
+		{name: "many small files over the size", files: []file{reg("a", strings.Repeat("a", 600<<10)), reg("b", strings.Repeat("b", 600<<10))}, want: ErrTooLarge},
+		{name: "too many entries", files: many, want: ErrTooManyEntries},
+	}
+	for _, test := range tests {
+		archives := map[string][]byte{"tar.gz": nil, "zip": nil}
+		archives["tar.gz"] = tarGz(t, test.files...)
+		if !test.tarOnly {
+			archives["zip"] = zipArchive(t, test.files...)
+		}
+		for kind, data := range archives {
+			if data == nil {
+				continue
+			}
+			format := TarGz
+			if kind == "zip" {
+				format = Zip
+			}
+			_, err := walk(format, data)
+			require.True(t, errors.Is(err, test.want), "%s (%s): got %v", test.name, kind, err)
+		}
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	require.Nil(t, WriteFile(dir, "bin/gogo", strings.NewReader("binary"), 0755))
+	data, err := os.ReadFile(filepath.Join(dir, "bin", "gogo"))
+	require.Nil(t, err)
+	require.Equal(t, "binary", string(data))
+
+	err = WriteFile(dir, "../evil", strings.NewReader("x"), 0755)
+	require.True(t, errors.Is(err, ErrPathTraversal))
+	var entryErr *EntryError
+	require.True(t, errors.As(err, &entryErr))
+
+	// a link planted at the destination is replaced, not written through
+	target := filepath.Join(t.TempDir(), "target")
+	require.Nil(t, os.WriteFile(target, []byte("target"), 0644))
+	require.Nil(t, os.Symlink(target, filepath.Join(dir, "gogo")))
+	require.Nil(t, WriteFile(dir, "gogo", strings.NewReader("binary"), 0755))
+	data, err = os.ReadFile(target)
+	require.Nil(t, err)
+	require.Equal(t, "target", string(data))
+}
+
+// FuzzWalk checks that no archive, however malformed, makes Walk panic or hand out an unsafe entry
+func FuzzWalk(f *testing.F) {
+	f.Add(tarGz(f, reg("gogo", "binary")), false)
+	f.Add(tarGz(f, reg("../evil", "x")), false)
+	f.Add(tarGz(f, file{name: "gogo", typeflag: tar.TypeSymlink, link: "/etc/passwd"}), false)
+	f.Add(zipArchive(f, reg("gogo", "binary")), true)
+	f.Add(zipArchive(f, reg("../evil", "x")), true)
+	f.Fuzz(func(t *testing.T, data []byte, isZip bool) {
+		format := TarGz
+		if isZip {
+			format = Zip
+		}
+		var size int64
+		_ = Walk(format, bytes.NewReader(data), int64(len(data)), func(entry Entry, r io.Reader) error {
+			if _, err := cleanName(entry.Name); err != nil || entry.Name != filepath.ToSlash(entry.Name) {
+				t.Fatalf("unsafe entry %q", entry.Name)
+			}
+			if !entry.Info.Mode().IsRegular() {
+				t.Fatalf("entry %q is not a regular file", entry.Name)
+			}
+			n, err := io.Copy(io.Discard, r)
+			size += n
+			return err
+		})
+		if size > MaxSize {
+			t.Fatalf("read %d bytes over the size limit", size)
+		}
+	})
+}
@@ -0,0 +1,211 @@
+package extract
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// ErrUnsupportedFormat is returned for assets that are neither a supported archive, a compressed file nor an executable
+var ErrUnsupportedFormat = errors.New("unsupported asset format")
+
+// maxZstdWindow bounds the memory a zstd stream can ask for
+const maxZstdWindow = 64 << 20
+
+// compression of the formats holding a single compressed file or a tar archive
+type compression uint
+
+const (
+	none compression = iota
+	gzipCompression
+	xzCompression
+	bzip2Compression
+	zstdCompression
+)
+
+var formats = []struct {
+	format      Format
+	name        string
+	extensions  []string
+	compression compression
+	archive     bool
+}{
+	{Zip, "zip", []string{".zip"}, none, true},
+	{TarGz, "tar.gz", []string{".tar.gz", ".tgz"}, gzipCompression, true},
+	{TarXz, "tar.xz", []string{".tar.xz", ".txz"}, xzCompression, true},
+	{TarBz2, "tar.bz2", []string{".tar.bz2", ".tbz2", ".tbz"}, bzip2Compression, true},
+	{TarZst, "tar.zst", []string{".tar.zst", ".tzst"}, zstdCompression, true},
+	{Tar, "tar", []string{".tar"}, none, true},
+	{Gz, "gz", []string{".gz"}, gzipCompression, false},
+	{Xz, "xz", []string{".xz"}, xzCompression, false},
+	{Bz2, "bz2", []string{".bz2"}, bzip2Compression, false},
+	{Zst, "zst", []string{".zst"}, zstdCompression, false},
+	{Binary, "binary", []string{".exe", ".bin", ".appimage"}, none, false},
+}
+
+func (f Format) String() string {
+	for _, known := range formats {
+		if known.format == f {
+			return known.name
+		}
+	}
+	return fmt.Sprintf("format(%d)", f)
+}
+
+// IsArchive reports whether the format holds several files walked with Walk, other formats
+// hold a single file read with Open
+func (f Format) IsArchive() bool {
+	for _, known := range formats {
+		if known.format == f {
+			return known.archive
+		}
+	}
+	return false
+}
+
+func (f Format) compression() compression {
+	for _, known := range formats {
+		if known.format == f {
+			return known.compression
+		}
+	}
+	return none
+}
+
+// FormatFromName returns the format of an asset from the extension of its name
+func FormatFromName(name string) (Format, bool) {
+	name = strings.ToLower(name)
+	for _, known := range formats {
+		for _, extension := range known.extensions {
+			if strings.HasSuffix(name, extension) {
+				return known.format, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// Detect returns the format of the asset of given name and size in r from its magic bytes. The name
+// decides between formats the content can't tell apart, like a tar archive without ustar header
+// and a compressed file, and the format of content without known magic bytes.
+func Detect(name string, r io.ReaderAt, size int64) (Format, error) {
+	header := make([]byte, 512)
+	n, err := r.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	header = header[:n]
+	byName, named := FormatFromName(name)
+
+	var c compression
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return Zip, nil
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		c = gzipCompression
+	case bytes.HasPrefix(header, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		c = xzCompression
+	case bytes.HasPrefix(header, []byte("BZh")):
+		c = bzip2Compression
+	case bytes.HasPrefix(header, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		c = zstdCompression
+	case isTar(header):
+		return Tar, nil
+	case isExecutable(header):
+		return Binary, nil
+	case named && byName.compression() == none:
+		return byName, nil
+	default:
+		return 0, ErrUnsupportedFormat
+	}
+
+	tarball := named && byName.IsArchive()
+	if !tarball {
+		// a compressed tar archive without tar extension is told apart by the header of its first entry
+		decompressed, err := decompress(c, io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return 0, err
+		}
+		inner := make([]byte, 512)
+		n, _ := io.ReadFull(decompressed, inner)
+		decompressed.Close()
+		tarball = isTar(inner[:n])
+	}
+	for _, known := range formats {
+		if known.compression == c && known.archive == tarball {
+			return known.format, nil
+		}
+	}
+	return 0, ErrUnsupportedFormat
+}
+
+// Open returns the content of an asset holding a single file, a compressed file or an executable,
+// reading more than MaxSize bytes from it fails with ErrTooLarge
+func Open(format Format, r io.Reader) (io.ReadCloser, error) {
+	if format.IsArchive() {
+		return nil, fmt.Errorf("%s is an archive", format)
+	}
+	data, err := decompress(format.compression(), r)
+	if err != nil {
+		return nil, err
+	}
+	return &limitedReadCloser{Reader: (&limiter{}).reader("", data), Closer: data}, nil
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// decompress returns the decompressed stream of r
+func decompress(c compression, r io.Reader) (io.ReadCloser, error) {
+	switch c {
+	case gzipCompression:
+		return gzip.NewReader(r)
+	case xzCompression:
+		xzReader, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(xzReader), nil
+	case bzip2Compression:
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	case zstdCompression:
+		decoder, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(maxZstdWindow))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	default:
+		return io.NopCloser(r), nil
+	}
+}
+
+// isTar reports whether header starts with a ustar or gnu tar header
+func isTar(header []byte) bool {
+	return len(header) >= 262 && bytes.Equal(header[257:262], []byte("ustar"))
+}
+
+// isExecutable reports whether header starts an elf, mach-o or pe executable or a script
+func isExecutable(header []byte) bool {
+	for _, magic := range [][]byte{
+		{0x7f, 'E', 'L', 'F'},
+		{0xfe, 0xed, 0xfa, 0xce}, {0xfe, 0xed, 0xfa, 0xcf},
+		{0xce, 0xfa, 0xed, 0xfe}, {0xcf, 0xfa, 0xed, 0xfe},
+		{0xca, 0xfe, 0xba, 0xbe},
+		[]byte("MZ"),
+		[]byte("#!"),
+	} {
+		if bytes.HasPrefix(header, magic) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package extract
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/dsnet/compress/bzip2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+	"github.com/ulikunitz/xz"
+)
+
+func compress(t *testing.T, c compression, data []byte) []byte {
+	buf := &bytes.Buffer{}
+	var w io.WriteCloser
+	var err error
+	switch c {
+	case gzipCompression:
+		w = gzip.NewWriter(buf)
+	case xzCompression:
+		w, err = xz.NewWriter(buf)
+	case bzip2Compression:
+		w, err = bzip2.NewWriter(buf, nil)
+	case zstdCompression:
+		w, err = zstd.NewWriter(buf)
+	}
+	require.Nil(t, err)
+	_, err = w.Write(data)
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+	return buf.Bytes()
+}
+
+func tarArchive(t *testing.T, files ...file) []byte {
+	buf := &bytes.Buffer{}
+	tarWriter := tar.NewWriter(buf)
+	for _, f := range files {
+		require.Nil(t, tarWriter.WriteHeader(&tar.Header{Name: f.name, Typeflag: tar.TypeReg, Mode: 0755, Size: int64(len(f.body))}))
+		_, err := tarWriter.Write([]byte(f.body))
+		require.Nil(t, err)
+	}
+	require.Nil(t, tarWriter.Close())
+	return buf.Bytes()
+}
+
+func TestDetect(t *testing.T) {
+	executable := "\x7fELF\x02\x01\x01binary"
+	archive := tarArchive(t, reg("gogo", executable))
+	tests := []struct {
+		name   string
+		data   []byte
+		format Format
+	}{
+		{"gogo_linux_amd64.tar.gz", compress(t, gzipCompression, archive), TarGz},
+		{"gogo_linux_amd64.tgz", compress(t, gzipCompression, archive), TarGz},
+		{"gogo_linux_amd64.tar.xz", compress(t, xzCompression, archive), TarXz},
+		{"gogo_linux_amd64.tar.bz2", compress(t, bzip2Compression, archive), TarBz2},
+		{"gogo_linux_amd64.tar.zst", compress(t, zstdCompression, archive), TarZst},
+		{"gogo_linux_amd64.tar", archive, Tar},
+		{"gogo_linux_amd64.zip", zipArchive(t, reg("gogo", executable)), Zip},
+		{"gogo_linux_amd64.gz", compress(t, gzipCompression, []byte(executable)), Gz},
+		{"gogo_linux_amd64.xz", compress(t, xzCompression, []byte(executable)), Xz},
+		{"gogo_linux_amd64.bz2", compress(t, bzip2Compression, []byte(executable)), Bz2},
+		{"gogo_linux_amd64.zst", compress(t, zstdCompression, []byte(executable)), Zst},
+		{"gogo_linux_amd64", []byte(executable), Binary},
+		{"gogo_windows_amd64.exe", []byte("MZ\x90\x00binary"), Binary},
+		{"gogo_darwin_arm64", []byte("\xcf\xfa\xed\xfebinary"), Binary},
+		// the content wins over a misleading name
+		{"gogo_linux_amd64.tar.gz", compress(t, xzCompression, archive), TarXz},
+		{"gogo_linux_amd64.zip", []byte(executable), Binary},
+		// compressed tar archives are recognized without extension
+		{"gogo_linux_amd64", compress(t, zstdCompression, archive), TarZst},
+		{"gogo_linux_amd64", compress(t, gzipCompression, []byte(executable)), Gz},
+	}
+	for _, test := range tests {
+		format, err := Detect(test.name, bytes.NewReader(test.data), int64(len(test.data)))
+		require.Nil(t, err, test.name)
+		require.Equal(t, test.format, format, "%s: got %s", test.name, format)
+
+		if format.IsArchive() {
+			entries, err := walk(format, test.data)
+			require.Nil(t, err, test.name)
+			require.Equal(t, map[string]string{"gogo": executable}, entries, test.name)
+			continue
+		}
+		r, err := Open(format, bytes.NewReader(test.data))
+		require.Nil(t, err, test.name)
+		data, err := io.ReadAll(r)
+		r.Close()
+		require.Nil(t, err, test.name)
+		if format == Binary {
+			require.Equal(t, test.data, data, test.name)
+		} else {
+			require.Equal(t, executable, string(data), test.name)
+		}
+	}
+}
+
+func TestDetectUnsupported(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"gogo_linux_amd64.deb":     []byte("!<arch>\ndebian-binary"),
+		"gogo_linux_amd64.7z":      []byte("7z\xbc\xaf\x27\x1c"),
+		"gogo_linux_amd64":         []byte("not an executable"),
+		"gogo_linux_amd64.tar.lz4": {0x04, 0x22, 0x4d, 0x18},
+		"gogo_linux_amd64.rpm":     {0xed, 0xab, 0xee, 0xdb},
+	} {
+		_, err := Detect(name, bytes.NewReader(data), int64(len(data)))
+		require.True(t, errors.Is(err, ErrUnsupportedFormat), "%s: got %v", name, err)
+	}
+}
+
+func TestOpenBomb(t *testing.T) {
+	defer func(size int64) { MaxSize = size }(MaxSize)
+	MaxSize = 1 << 20
+	data := compress(t, zstdCompression, []byte(strings.Repeat("\x00", 4<<20)))
+	r, err := Open(Zst, bytes.NewReader(data))
+	require.Nil(t, err)
+	defer r.Close()
+	_, err = io.Copy(io.Discard, r)
+	require.True(t, errors.Is(err, ErrTooLarge), "got %v", err)
+}
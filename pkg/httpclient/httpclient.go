@@ -0,0 +1,191 @@
+// Package httpclient builds the http clients used for every network request of crtm
+// from the proxy, tls and timeout settings of the command line and config file.
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/chainreactors/crtm/pkg/mirror"
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+// Options of the http clients
+type Options struct {
+	// Proxy is a http, https or socks5 proxy url, the environment proxy (HTTPS_PROXY...) is used if empty
+	Proxy string
+	// CACert is a pem file of certificate authorities trusted in addition to the system ones
+	CACert string
+	// Insecure disables the verification of server certificates
+	Insecure bool
+	// ConnectTimeout bounds the connection and tls handshake
+	ConnectTimeout time.Duration
+	// ReadTimeout bounds the wait for the response headers and for each read of the body
+	ReadTimeout time.Duration
+	// UserAgent is sent with every request
+	UserAgent string
+	// Retries is the number of retries of requests failing with a transient error
+	Retries int
+	// RateLimitWait is the longest wait for the reset of an exhausted rate limit or a Retry-After
+	// header, requests fail immediately when it resets later. Backoff delays aren't bound by it.
+	RateLimitWait time.Duration
+}
+
+// DefaultOptions are used until Configure is called
+var DefaultOptions = Options{
+	ConnectTimeout: 10 * time.Second,
+	ReadTimeout:    30 * time.Second,
+	UserAgent:      "crtm",
+	Retries:        3,
+	RateLimitWait:  time.Minute,
+}
+
+var (
+	mu      sync.RWMutex
+	current = mustTransport(DefaultOptions)
+)
+
+// Configure applies options to every client returned by New, including clients created before
+func Configure(options Options) error {
+	transport, err := newTransport(options)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	current = transport
+	mu.Unlock()
+	return nil
+}
+
+// New returns a http client using the configured transport and the github mirrors
+func New() *http.Client {
+	return &http.Client{Transport: &mirror.Transport{Base: sharedTransport{}}}
+}
+
+// sharedTransport sends requests with the transport set by Configure
+type sharedTransport struct{}
+
+func (sharedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	mu.RLock()
+	transport := current
+	mu.RUnlock()
+	return transport.RoundTrip(req)
+}
+
+func mustTransport(options Options) http.RoundTripper {
+	transport, err := newTransport(options)
+	if err != nil {
+		panic(err)
+	}
+	return transport
+}
+
+func newTransport(options Options) (http.RoundTripper, error) {
+	proxy := http.ProxyFromEnvironment
+	if options.Proxy != "" {
+		proxyURL, err := url.Parse(options.Proxy)
+		if err != nil {
+			return nil, errorutil.NewWithErr(err).Msgf("invalid proxy %s", options.Proxy)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, errorutil.NewWithTag("httpclient", "unsupported proxy scheme %q (http, https or socks5)", proxyURL.Scheme)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: options.Insecure}
+	if options.CACert != "" {
+		pem, err := os.ReadFile(options.CACert)
+		if err != nil {
+			return nil, errorutil.NewWithErr(err).Msgf("could not read ca bundle")
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errorutil.NewWithTag("httpclient", "no certificate found in %s", options.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	dialer := &net.Dialer{Timeout: options.ConnectTimeout, KeepAlive: 30 * time.Second}
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   options.ConnectTimeout,
+		ResponseHeaderTimeout: options.ReadTimeout,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	retry := &retryTransport{base: transport, retries: options.Retries, maxWait: options.RateLimitWait}
+	return &userAgentTransport{base: retry, userAgent: options.UserAgent, readTimeout: options.ReadTimeout}, nil
+}
+
+// userAgentTransport sets the User-Agent of requests and aborts responses whose body stalls
+type userAgentTransport struct {
+	base        http.RoundTripper
+	userAgent   string
+	readTimeout time.Duration
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	if t.userAgent != "" {
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+	if t.readTimeout <= 0 {
+		return t.base.RoundTrip(req)
+	}
+	ctx, cancel := context.WithCancel(req.Context())
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &idleTimeoutBody{
+		body:    resp.Body,
+		timeout: t.readTimeout,
+		timer:   time.AfterFunc(t.readTimeout, cancel),
+		cancel:  cancel,
+	}
+	return resp, nil
+}
+
+// idleTimeoutBody cancels the request when no data was read for timeout
+type idleTimeoutBody struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	cancel  context.CancelFunc
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	b.timer.Reset(b.timeout)
+	n, err := b.body.Read(p)
+	if err != nil && err != io.EOF && !b.timer.Stop() {
+		err = fmt.Errorf("read timeout after %s: %w", b.timeout, err)
+	}
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	err := b.body.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,89 @@
+package httpclient
+
+import (
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserAgent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.UserAgent()))
+	}))
+	defer server.Close()
+	defer func() { require.Nil(t, Configure(DefaultOptions)) }()
+
+	options := DefaultOptions
+	options.UserAgent = "crtm/test"
+	require.Nil(t, Configure(options))
+	resp, err := New().Get(server.URL)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Equal(t, "crtm/test", string(body))
+}
+
+func TestTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	defer func() { require.Nil(t, Configure(DefaultOptions)) }()
+
+	_, err := New().Get(server.URL)
+	require.NotNil(t, err, "self signed certificates must be rejected by default")
+
+	caCert := filepath.Join(t.TempDir(), "ca.pem")
+	require.Nil(t, os.WriteFile(caCert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644))
+	options := DefaultOptions
+	options.CACert = caCert
+	require.Nil(t, Configure(options))
+	resp, err := New().Get(server.URL)
+	require.Nil(t, err)
+	resp.Body.Close()
+
+	options = DefaultOptions
+	options.Insecure = true
+	require.Nil(t, Configure(options))
+	resp, err = New().Get(server.URL)
+	require.Nil(t, err)
+	resp.Body.Close()
+}
+
+func TestInvalidOptions(t *testing.T) {
+	options := DefaultOptions
+	options.Proxy = "ftp://127.0.0.1:21"
+	require.NotNil(t, Configure(options))
+
+	options = DefaultOptions
+	options.CACert = filepath.Join(t.TempDir(), "missing.pem")
+	require.NotNil(t, Configure(options))
+}
+
+func TestReadTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+	defer func() { require.Nil(t, Configure(DefaultOptions)) }()
+
+	options := DefaultOptions
+	options.ReadTimeout = 100 * time.Millisecond
+	require.Nil(t, Configure(options))
+	resp, err := New().Get(server.URL)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	_, err = io.ReadAll(resp.Body)
+	require.NotNil(t, err, "stalled body must time out")
+}
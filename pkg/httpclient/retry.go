@@ -0,0 +1,213 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/projectdiscovery/gologger"
+)
+
+var (
+	// baseDelay is the backoff before the first retry, doubled for every following retry
+	baseDelay = 500 * time.Millisecond
+	// maxDelay caps the backoff between retries
+	maxDelay = 30 * time.Second
+)
+
+// RateLimit is the request budget of a host, read from the X-RateLimit-* response headers
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// RateLimitError is returned without sending the request when the budget of a host is
+// exhausted and resets later than the allowed wait
+type RateLimitError struct {
+	Host  string
+	Reset time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s rate limit exceeded, resets at %s (set GITHUB_TOKEN to raise it)", e.Host, e.Reset.Format("15:04:05"))
+}
+
+var (
+	rateLimitsMu sync.Mutex
+	rateLimits   = map[string]RateLimit{}
+)
+
+// RateLimits returns the last known request budget of every host
+func RateLimits() map[string]RateLimit {
+	rateLimitsMu.Lock()
+	defer rateLimitsMu.Unlock()
+	limits := make(map[string]RateLimit, len(rateLimits))
+	for host, limit := range rateLimits {
+		limits[host] = limit
+	}
+	return limits
+}
+
+// retryTransport retries transient failures with exponential backoff and jitter and waits
+// for the reset of exhausted rate limits
+type retryTransport struct {
+	base    http.RoundTripper
+	retries int
+	maxWait time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// requests with a body can't be replayed
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	for attempt := 0; ; attempt++ {
+		if limit, ok := exhausted(req.URL.Host); ok {
+			wait := time.Until(limit.Reset)
+			if wait > t.maxWait {
+				return nil, &RateLimitError{Host: req.URL.Host, Reset: limit.Reset}
+			}
+			gologger.Verbose().Msgf("%s rate limit exhausted, waiting %s for reset", req.URL.Host, wait.Round(time.Second))
+			if err := sleep(req.Context(), wait); err != nil {
+				return nil, err
+			}
+		}
+		// the request of the caller isn't modified, replays are sent with a clone holding a new body
+		attemptReq := req
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Body = body
+		}
+
+		resp, err := t.base.RoundTrip(attemptReq)
+		if err == nil {
+			recordRateLimit(req.URL.Host, resp.Header)
+		}
+		delay, limited, retry := retryDelay(req, resp, err, attempt)
+		// only rate limit waits are capped, backoff delays are bounded by maxDelay
+		if !retry || !replayable || attempt >= t.retries || (limited && delay > t.maxWait) {
+			return resp, err
+		}
+		var reason string
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+			resp.Body.Close()
+		}
+		gologger.Verbose().Msgf("retrying %s %s in %s (%d/%d): %s", req.Method, req.URL.Redacted(), delay.Round(time.Millisecond), attempt+1, t.retries, reason)
+		if err := sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryDelay returns the delay before retrying a request, limited if it is the wait asked by a rate limit
+// or Retry-After header, and false if its failure isn't transient
+func retryDelay(req *http.Request, resp *http.Response, err error, attempt int) (delay time.Duration, limited bool, retry bool) {
+	if err != nil {
+		var certErr *tls.CertificateVerificationError
+		var dnsErr *net.DNSError
+		if req.Context().Err() != nil || errors.As(err, &certErr) || (errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+			return 0, false, false
+		}
+		return backoff(attempt), false, true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusForbidden:
+		if after, ok := retryAfter(resp.Header); ok {
+			return after, true, true
+		}
+		if limit, ok := parseRateLimit(resp.Header); ok && limit.Remaining == 0 {
+			return time.Until(limit.Reset) + time.Second, true, true
+		}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return backoff(attempt), false, true
+		}
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return backoff(attempt), false, true
+	}
+	return 0, false, false
+}
+
+// backoff returns an exponential delay, randomized between half and all of it
+func backoff(attempt int) time.Duration {
+	delay := baseDelay << attempt
+	if delay <= 0 || delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func retryAfter(header http.Header) (time.Duration, bool) {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date), true
+	}
+	return 0, false
+}
+
+// parseRateLimit reads the github (X-RateLimit-*) and gitlab (RateLimit-*) rate limit headers
+func parseRateLimit(header http.Header) (RateLimit, bool) {
+	for _, prefix := range []string{"X-RateLimit-", "RateLimit-"} {
+		remaining, err := strconv.Atoi(header.Get(prefix + "Remaining"))
+		if err != nil {
+			continue
+		}
+		limit, _ := strconv.Atoi(header.Get(prefix + "Limit"))
+		reset, _ := strconv.ParseInt(header.Get(prefix+"Reset"), 10, 64)
+		return RateLimit{Limit: limit, Remaining: remaining, Reset: time.Unix(reset, 0)}, true
+	}
+	return RateLimit{}, false
+}
+
+func recordRateLimit(host string, header http.Header) {
+	limit, ok := parseRateLimit(header)
+	if !ok {
+		return
+	}
+	rateLimitsMu.Lock()
+	rateLimits[host] = limit
+	rateLimitsMu.Unlock()
+	gologger.Verbose().Msgf("%s rate limit: %d/%d remaining, resets in %s", host, limit.Remaining, limit.Limit, time.Until(limit.Reset).Round(time.Second))
+}
+
+// exhausted returns the rate limit of host if its budget is exhausted until a future reset
+func exhausted(host string) (RateLimit, bool) {
+	rateLimitsMu.Lock()
+	defer rateLimitsMu.Unlock()
+	limit, ok := rateLimits[host]
+	return limit, ok && limit.Remaining == 0 && time.Now().Before(limit.Reset)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
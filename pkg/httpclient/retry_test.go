@@ -0,0 +1,135 @@
+package httpclient
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetry(t *testing.T) {
+	defer func(delay time.Duration) { baseDelay = delay }(baseDelay)
+	baseDelay = time.Millisecond
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&requests, 1) {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			_, _ = w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+
+	resp, err := New().Get(server.URL)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, int32(3), requests)
+
+	// client errors aren't retried
+	atomic.StoreInt32(&requests, 0)
+	notFound := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer notFound.Close()
+	resp, err = New().Get(notFound.URL)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, int32(1), requests)
+}
+
+func TestRetryWithoutRateLimitWait(t *testing.T) {
+	defer func(delay time.Duration) { baseDelay = delay }(baseDelay)
+	baseDelay = time.Millisecond
+
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// a zero rate limit wait doesn't disable the backoff of server errors
+	transport := &retryTransport{base: http.DefaultTransport, retries: 2}
+	req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("crtm"))
+	require.Nil(t, err)
+	body := req.Body
+	resp, err := transport.RoundTrip(req)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, []string{"crtm", "crtm"}, bodies)
+	require.True(t, body == req.Body, "the request of the caller must not be modified")
+}
+
+func TestRateLimit(t *testing.T) {
+	var requests int32
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("X-RateLimit-Limit", "60")
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+	host := server.Listener.Addr().String()
+	defer func() {
+		rateLimitsMu.Lock()
+		delete(rateLimits, host)
+		rateLimitsMu.Unlock()
+	}()
+
+	// the reset is later than the allowed wait, the rate limit response is returned as is
+	resp, err := New().Get(server.URL)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	require.Equal(t, RateLimit{Limit: 60, Remaining: 0, Reset: reset}, RateLimits()[host])
+
+	// following requests fail without being sent until the reset
+	_, err = New().Get(server.URL)
+	var rateLimitErr *RateLimitError
+	require.True(t, errors.As(err, &rateLimitErr))
+	require.Equal(t, reset, rateLimitErr.Reset)
+	require.Equal(t, int32(1), requests)
+}
+
+func TestParseRateLimit(t *testing.T) {
+	header := http.Header{}
+	_, ok := parseRateLimit(header)
+	require.False(t, ok)
+
+	header.Set("RateLimit-Remaining", "10")
+	header.Set("RateLimit-Limit", "2000")
+	header.Set("RateLimit-Reset", "1700000000")
+	limit, ok := parseRateLimit(header)
+	require.True(t, ok)
+	require.Equal(t, RateLimit{Limit: 2000, Remaining: 10, Reset: time.Unix(1700000000, 0)}, limit)
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt := 0; attempt < 10; attempt++ {
+		delay := backoff(attempt)
+		require.True(t, delay >= baseDelay/2, "backoff %d: %s", attempt, delay)
+		require.True(t, delay <= maxDelay, "backoff %d: %s", attempt, delay)
+	}
+}
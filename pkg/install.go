@@ -1,25 +1,28 @@
 package pkg
 
 import (
-	"archive/tar"
-	"archive/zip"
-	"bytes"
-	"compress/gzip"
-	"context"
+	"errors"
 	"fmt"
 	"github.com/chainreactors/crtm/pkg/utils"
 	osutils "github.com/projectdiscovery/utils/os"
 	"io"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/chainreactors/crtm/pkg/cache"
+	"github.com/chainreactors/crtm/pkg/extract"
 	ospath "github.com/chainreactors/crtm/pkg/path"
+	"github.com/chainreactors/crtm/pkg/provider"
+	"github.com/chainreactors/crtm/pkg/signature"
+	"github.com/chainreactors/crtm/pkg/state"
+	"github.com/chainreactors/crtm/pkg/store"
 	"github.com/chainreactors/crtm/pkg/types"
-	"github.com/google/go-github/github"
 	"github.com/logrusorgru/aurora/v4"
 	"github.com/projectdiscovery/gologger"
 )
@@ -31,15 +34,27 @@ var (
 
 // Install installs given tool at path
 func Install(path string, tool types.Tool) error {
+	defer lockTool(tool.Name)()
 	if _, exists := ospath.GetExecutablePath(path, tool.Name); exists {
 		return types.ErrIsInstalled
 	}
-	gologger.Info().Msgf("installing %s...", tool.Name)
+	if err := checkConstraint(tool); err != nil {
+		return err
+	}
+	logger(tool).Info().Msgf("installing %s...", tool.Name)
 	version, err := install(tool, path)
 	if err != nil {
 		return err
 	}
-	gologger.Info().Msgf("installed %s %s (%s)", tool.Name, version, au.BrightGreen("latest").String())
+	logger(tool).Info().Msgf("installed %s %s (%s)", tool.Name, version, au.BrightGreen(tool.VersionLabel()).String())
+	return nil
+}
+
+// checkConstraint returns ErrOutsideConstraint if no release satisfies the version constraint of the tool
+func checkConstraint(tool types.Tool) error {
+	if tool.OutsideConstraint {
+		return fmt.Errorf("%w %s, latest release is %s", types.ErrOutsideConstraint, tool.Constraint, tool.Version)
+	}
 	return nil
 }
 
@@ -58,175 +73,286 @@ func GoInstall(path string, tool types.Tool) error {
 	return nil
 }
 
+// install downloads the tool release into the version store and activates it in path,
+// versions already present in the store are activated without downloading them again
 func install(tool types.Tool, path string) (string, error) {
-	var id int64
-	var isZip, isTar bool
-loop:
-	for asset, assetID := range tool.Assets {
-		switch {
-		case strings.Contains(asset, ".zip"):
-			if isAsset(asset, tool.Name, runtime.GOOS, runtime.GOARCH) {
-				id = assetID
-				isZip = true
-				break loop
-			}
-		case strings.Contains(asset, ".tar.gz"):
-			if isAsset(asset, tool.Name, runtime.GOOS, runtime.GOARCH) {
-				id = assetID
-				isTar = true
-				break loop
-			}
-		default:
-			if isAsset(asset, tool.Name, runtime.GOOS, runtime.GOARCH) {
-				id = assetID
-				break loop
-			}
+	if _, exists := store.Executable(tool.Name, tool.Version); exists {
+		if err := store.Activate(path, tool.Name, tool.Version); err != nil {
+			return "", err
 		}
+		return tool.Version, ensureReceipt(tool)
 	}
+	return installRelease(tool, path)
+}
 
-	// handle if id is zero (no asset found)
-	if id == 0 {
+// installRelease downloads the tool release into the version store and activates it in path, a version
+// already present in the store is replaced once the download is verified and extracted
+func installRelease(tool types.Tool, path string) (string, error) {
+	_, replaced := store.Executable(tool.Name, tool.Version)
+	assetName, id, ok := findAsset(tool, runtime.GOOS, runtime.GOARCH)
+	if !ok {
 		return "", fmt.Errorf(types.ErrNoAssetFound, runtime.GOOS, runtime.GOARCH)
 	}
 
-	_, rdurl, err := utils.GithubClient().Repositories.DownloadReleaseAsset(context.Background(), types.Organization, tool.Repo, int64(id))
+	asset, err := openInstallAsset(tool, assetName, id)
 	if err != nil {
-		if arlErr, ok := err.(*github.AbuseRateLimitError); ok {
-			// Provide user with more info regarding the rate limit
-			gologger.Error().Msgf("error for remaining request per hour: %s, RetryAfter: %s", err.Error(), arlErr.RetryAfter)
-		}
 		return "", err
 	}
-
-	resp, err := http.Get(rdurl)
+	// nothing is extracted before the asset is verified, versions are extracted to a staging directory
+	// moved to the store at once so that a failed or interrupted install leaves the active version untouched
+	if asset.expected != "" && !strings.EqualFold(asset.expected, asset.sha256) {
+		asset.discard()
+		return "", fmt.Errorf("%s: checksum mismatch expected %s but got %s", assetName, asset.expected, asset.sha256)
+	}
+	stagingDir, err := store.Stage(tool.Name)
 	if err != nil {
+		asset.discard()
 		return "", err
 	}
-
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
+	err = extractExecutable(asset, assetName, tool.Name, stagingDir)
+	if _, exists := ospath.GetExecutablePath(stagingDir, tool.Name); err == nil && !exists {
+		err = fmt.Errorf("%s: executable %s not found in the release asset", assetName, tool.Name)
+	}
+	if err == nil {
+		err = store.Commit(stagingDir, tool.Name, tool.Version)
+	}
+	if err != nil {
+		asset.discard()
+		store.Discard(stagingDir)
 		return "", err
 	}
-
-	switch {
-	case isZip:
-		err := downloadZip(resp.Body, tool.Name, path)
-		if err != nil {
-			return "", err
-		}
-	case isTar:
-		err := downloadTar(resp.Body, tool.Name, path)
-		if err != nil {
-			return "", err
-		}
-	default:
-		err := downloadBin(resp.Body, tool.Name, path)
-		if err != nil {
-			return "", err
+	if err = recordReceipt(tool, assetName, id, asset.sha256); err == nil {
+		err = store.Activate(path, tool.Name, tool.Version)
+	}
+	if err != nil {
+		asset.discard()
+		if !replaced {
+			_ = os.RemoveAll(store.VersionDir(tool.Name, tool.Version))
 		}
+		return "", err
 	}
+	asset.keep(tool, assetName)
 	return tool.Version, nil
 }
 
-func isAsset(asset, name, os, arch string) bool {
-	if strings.Contains(asset, name) && strings.Contains(asset, os) && strings.Contains(asset, arch) {
-		return true
+// installAsset is a release asset on disk, a cached blob or a download written to a partial or temporary file
+type installAsset struct {
+	file     *os.File
+	size     int64
+	sha256   string
+	expected string
+	// cacheable is set for downloads written to a partial file of the cache
+	cacheable bool
+	download  bool
+	// verified is set when expected comes from checksums whose signature checks weren't skipped
+	verified bool
+}
+
+// discard closes the asset and removes it when it was downloaded
+func (a *installAsset) discard() {
+	if a.download {
+		cache.Discard(a.file)
+		return
 	}
-	return false
+	a.file.Close()
 }
 
-func downloadTar(reader io.Reader, toolName, path string) error {
-	gzipReader, err := gzip.NewReader(reader)
-	if err != nil {
-		return err
+// keep adds a downloaded asset to the cache once it is installed
+func (a *installAsset) keep(tool types.Tool, assetName string) {
+	if !a.cacheable {
+		a.discard()
+		return
+	}
+	if err := cache.Commit(a.file, tool.RepoPath(), tool.Version, assetName, a.sha256, a.verified); err != nil {
+		logger(tool).Warning().Msgf("%s: could not cache %s: %s", tool.Name, assetName, err)
 	}
-	tarReader := tar.NewReader(gzipReader)
-	// iterate through the files in the archive
-	for {
-		header, err := tarReader.Next()
-		if err == io.EOF {
-			break
+}
+
+// errCacheMismatch is returned for cached blobs not matching their content address or the release checksums
+var errCacheMismatch = errors.New("cached asset doesn't match its checksum")
+
+// openInstallAsset returns the asset from the download cache or downloads it to a partial file of the cache
+// while it is hashed, so that it is never held in memory whatever its size. The expected sha256 is set from
+// the release checksums, a cached blob that doesn't match is evicted and downloaded again.
+func openInstallAsset(tool types.Tool, assetName string, id int64) (*installAsset, error) {
+	repo := tool.RepoPath()
+	if blob, entry, ok := cache.Open(repo, tool.Version, assetName); ok {
+		asset, err := openCachedAsset(tool, assetName, blob, entry)
+		if !errors.Is(err, errCacheMismatch) {
+			return asset, err
 		}
-		if err != nil {
-			return err
+		logger(tool).Warning().Msgf("%s: %s, downloading it again", tool.Name, err)
+		if err := cache.Evict(repo, tool.Version, assetName); err != nil {
+			logger(tool).Warning().Msgf("%s: could not evict %s from the cache: %s", tool.Name, assetName, err)
 		}
-		if !strings.EqualFold(strings.TrimSuffix(header.FileInfo().Name(), WindowExt), toolName) {
-			continue
+	}
+
+	expected, err := assetChecksum(tool, assetName)
+	if err != nil {
+		return nil, err
+	}
+	p, err := utils.GetProvider(tool)
+	if err != nil {
+		return nil, err
+	}
+	// only downloads checked against a published sha256 are resumed, a partial file mixing two
+	// different contents would otherwise go unnoticed
+	resume := expected != ""
+	asset := &installAsset{expected: expected, cacheable: true, download: true, verified: expected != "" && !signature.AllowUnsigned}
+	if asset.file, err = cache.Partial(tool.RepoPath(), tool.Version, assetName); err != nil {
+		logger(tool).Warning().Msgf("%s: could not cache %s: %s", tool.Name, assetName, err)
+		asset.cacheable, resume = false, false
+		if asset.file, err = os.CreateTemp("", "crtm-download-*"); err != nil {
+			return nil, err
 		}
-		// if the file is not a directory, extract it
-		if !header.FileInfo().IsDir() {
-			filePath := filepath.Join(path, header.FileInfo().Name())
-			if !strings.HasPrefix(filePath, filepath.Clean(path)+string(os.PathSeparator)) {
-				return err
-			}
+	}
+	providerAsset := provider.Asset{ID: id, Name: assetName, URL: tool.AssetURLs[assetName]}
+	asset.sha256, asset.size, err = downloadAsset(tool, p, providerAsset, asset.file, resume)
+	if err == nil {
+		_, err = asset.file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		if resume {
+			// the partial download is kept to be resumed
+			asset.file.Close()
+		} else {
+			asset.discard()
+		}
+		return nil, err
+	}
+	return asset, nil
+}
 
-			if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
-				return err
-			}
+// openCachedAsset returns a cached blob once its content is checked against its content address and the
+// checksum pinned by a lockfile or bundle. Blobs not verified when cached are checked against the release
+// checksums, with the same signature requirements as a download.
+func openCachedAsset(tool types.Tool, assetName string, blob *os.File, entry cache.Entry) (*installAsset, error) {
+	asset := &installAsset{file: blob}
+	var err error
+	if expected, ok := tool.Checksums[assetName]; ok {
+		asset.expected = expected
+	} else if entry.Verified {
+		asset.expected = entry.SHA256
+	} else if asset.expected, err = assetChecksum(tool, assetName); err != nil {
+		asset.discard()
+		return nil, err
+	}
+	if asset.sha256, asset.size, err = hashFile(blob); err == nil {
+		_, err = blob.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		asset.discard()
+		return nil, err
+	}
+	if !strings.EqualFold(asset.sha256, entry.SHA256) || (asset.expected != "" && !strings.EqualFold(asset.sha256, asset.expected)) {
+		asset.discard()
+		return nil, fmt.Errorf("%s: %w", assetName, errCacheMismatch)
+	}
+	logger(tool).Verbose().Msgf("using cached %s", assetName)
+	return asset, nil
+}
 
-			dstFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, header.FileInfo().Mode())
-			if err != nil {
-				return err
-			}
-			defer dstFile.Close()
-			// copy the file data from the archive
-			_, err = io.Copy(dstFile, tarReader)
-			if err != nil {
-				return err
-			}
-			// set the file permissions
-			err = os.Chmod(dstFile.Name(), 0755)
-			if err != nil {
-				return err
-			}
+// findAsset returns the release asset of tool for given platform
+func findAsset(tool types.Tool, goos, goarch string) (string, int64, bool) {
+	names := make([]string, 0, len(tool.Assets))
+	for asset := range tool.Assets {
+		names = append(names, asset)
+	}
+	sort.Strings(names)
+	for _, asset := range names {
+		if isAsset(asset, tool, goos, goarch) {
+			return asset, tool.Assets[asset], true
 		}
 	}
-	return nil
+	return "", 0, false
 }
 
-func downloadZip(reader io.Reader, toolName, path string) error {
-	buff := bytes.NewBuffer([]byte{})
-	size, err := io.Copy(buff, reader)
+// recordReceipt records the installed files of a tool version in the state file
+func recordReceipt(tool types.Tool, assetName string, assetID int64, assetSHA256 string) error {
+	files, err := state.HashFiles(store.VersionDir(tool.Name, tool.Version))
 	if err != nil {
 		return err
 	}
-	zipReader, err := zip.NewReader(bytes.NewReader(buff.Bytes()), size)
+	return state.Update(func(s *state.State) error {
+		s.Put(&state.Receipt{
+			Tool:        tool.Name,
+			Version:     tool.Version,
+			Provider:    tool.Provider,
+			Repo:        tool.RepoPath(),
+			Asset:       assetName,
+			AssetID:     assetID,
+			AssetSHA256: assetSHA256,
+			Files:       files,
+			Channel:     tool.ReleaseChannel,
+			Pinned:      tool.Pinned,
+			InstalledAt: time.Now(),
+		})
+		return nil
+	})
+}
+
+// ensureReceipt records a receipt for versions installed in the store before the state file existed
+func ensureReceipt(tool types.Tool) error {
+	s, err := state.Load()
 	if err != nil {
 		return err
 	}
-	for _, f := range zipReader.File {
-		if !strings.EqualFold(strings.TrimSuffix(f.Name, WindowExt), toolName) {
-			continue
-		}
-		filePath := filepath.Join(path, f.Name)
-		if !strings.HasPrefix(filePath, filepath.Clean(path)+string(os.PathSeparator)) {
-			return err
-		}
-
-		if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
-			return err
-		}
+	if _, ok := s.Receipt(tool.Name, tool.Version); ok {
+		return nil
+	}
+	return recordReceipt(tool, "", 0, "")
+}
 
-		dstFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
-		if err != nil {
-			return err
-		}
+func isAsset(asset string, tool types.Tool, os, arch string) bool {
+	if tool.AssetPattern != "" {
+		return matchAssetPattern(tool.AssetPattern, asset, tool, os, arch)
+	}
+	if strings.Contains(asset, tool.Name) && strings.Contains(asset, os) && strings.Contains(asset, arch) {
+		return true
+	}
+	return false
+}
 
-		fileInArchive, err := f.Open()
-		if err != nil {
-			return err
-		}
+// matchAssetPattern matches asset against a registry asset pattern. the pattern is a regular
+// expression where {name}, {version}, {os} and {arch} are replaced with the tool values
+func matchAssetPattern(pattern, asset string, tool types.Tool, os, arch string) bool {
+	replacer := strings.NewReplacer(
+		"{name}", regexp.QuoteMeta(tool.Name),
+		"{version}", regexp.QuoteMeta(tool.Version),
+		"{os}", regexp.QuoteMeta(os),
+		"{arch}", regexp.QuoteMeta(arch),
+	)
+	re, err := regexp.Compile("^" + replacer.Replace(pattern) + "$")
+	if err != nil {
+		logger(tool).Warning().Msgf("%s: invalid asset pattern %q: %s", tool.Name, pattern, err)
+		return false
+	}
+	return re.MatchString(asset)
+}
 
-		if _, err := io.Copy(dstFile, fileInArchive); err != nil {
-			return err
-		}
-		err = os.Chmod(dstFile.Name(), 0755)
-		if err != nil {
-			return err
+// extractExecutable writes the executable of the tool to path from the asset, an archive holding it,
+// the executable compressed or the executable itself, told apart by their magic bytes
+func extractExecutable(asset *installAsset, assetName, toolName, path string) error {
+	format, err := extract.Detect(assetName, asset.file, asset.size)
+	switch {
+	case err != nil:
+	case format.IsArchive():
+		err = extract.Walk(format, asset.file, asset.size, func(entry extract.Entry, data io.Reader) error {
+			name := entry.Info.Name()
+			if !strings.EqualFold(strings.TrimSuffix(name, WindowExt), toolName) {
+				return nil
+			}
+			return extract.WriteFile(path, name, data, 0755)
+		})
+	default:
+		var data io.ReadCloser
+		if data, err = extract.Open(format, io.NewSectionReader(asset.file, 0, asset.size)); err == nil {
+			err = downloadBin(data, toolName, path)
+			data.Close()
 		}
-
-		dstFile.Close()
-		fileInArchive.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", assetName, err)
 	}
 	return nil
 }
@@ -0,0 +1,115 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/chainreactors/crtm/pkg/lockfile"
+	"github.com/chainreactors/crtm/pkg/signature"
+	"github.com/chainreactors/crtm/pkg/state"
+	"github.com/chainreactors/crtm/pkg/store"
+	"github.com/chainreactors/crtm/pkg/types"
+	"github.com/projectdiscovery/gologger"
+)
+
+// LockPlatforms are the platforms whose assets are recorded in lockfiles
+var LockPlatforms = []string{
+	"linux/amd64", "linux/arm64", "linux/386",
+	"darwin/amd64", "darwin/arm64",
+	"windows/amd64", "windows/arm64", "windows/386",
+}
+
+// Lock returns the lockfile entry of the tool release with the asset and sha256 of every platform.
+// checksums are taken from the release checksums file, assets missing from it are downloaded and hashed.
+// The checksums file must be signed by the pinned keys of the tool unless unsigned releases are allowed.
+func Lock(tool types.Tool) (lockfile.Tool, error) {
+	entry := lockfile.Tool{
+		Name:     tool.Name,
+		Org:      tool.GetOrg(),
+		Repo:     tool.Repo,
+		Provider: tool.Provider,
+		URL:      tool.ProviderURL,
+		Version:  tool.Version,
+		Assets:   map[string]lockfile.Asset{},
+	}
+	// only releases without checksums file are hashed, signature errors of the checksums file are returned
+	checksums, err := releaseChecksums(tool)
+	switch {
+	case errors.Is(err, types.ErrNoChecksum):
+		gologger.Verbose().Msgf("%s: %s, hashing assets", tool.Name, err)
+	case err != nil:
+		return entry, err
+	}
+	keys, err := pinnedKeys(tool)
+	if err != nil {
+		return entry, err
+	}
+	for _, platform := range LockPlatforms {
+		goos, goarch, _ := strings.Cut(platform, "/")
+		assetName, _, ok := findAsset(tool, goos, goarch)
+		if !ok {
+			continue
+		}
+		sum, ok := checksums[assetName]
+		if !ok {
+			// an asset missing from a signed checksums file is as unverified as a missing signature
+			if checksums != nil && len(keys) > 0 {
+				if err := allowUnsigned(tool, fmt.Errorf("%s: %w", assetName, signature.ErrUnsigned)); err != nil {
+					return entry, err
+				}
+			}
+			if sum, err = hashAsset(tool, assetName); err != nil {
+				return entry, fmt.Errorf("%s: %w", assetName, err)
+			}
+		}
+		entry.Assets[platform] = lockfile.Asset{Name: assetName, SHA256: strings.ToLower(sum)}
+	}
+	if len(entry.Assets) == 0 {
+		return entry, fmt.Errorf("%s %s: no release asset found for any platform", tool.Name, tool.Version)
+	}
+	return entry, nil
+}
+
+// InstallLocked installs the exact release asset recorded in the lockfile entry at path.
+// the install fails if the sha256 of the asset doesn't match the locked one.
+func InstallLocked(path string, tool types.Tool, entry lockfile.Tool) error {
+	defer lockTool(tool.Name)()
+	asset, ok := entry.Assets[lockfile.Platform(runtime.GOOS, runtime.GOARCH)]
+	if !ok {
+		return fmt.Errorf("%s %s: no locked asset for %s/%s", tool.Name, entry.Version, runtime.GOOS, runtime.GOARCH)
+	}
+	id, ok := tool.Assets[asset.Name]
+	if !ok {
+		return fmt.Errorf("%s %s: locked asset %s not found in release", tool.Name, entry.Version, asset.Name)
+	}
+	tool.Assets = map[string]int64{asset.Name: id}
+	tool.Checksums = map[string]string{asset.Name: asset.SHA256}
+	tool.Pinned = true
+
+	installFunc := install
+	if _, exists := store.Executable(tool.Name, tool.Version); exists {
+		s, err := state.Load()
+		if err != nil {
+			return err
+		}
+		receipt, ok := s.Receipt(tool.Name, tool.Version)
+		switch {
+		case ok && receipt.Asset == asset.Name && strings.EqualFold(receipt.AssetSHA256, asset.SHA256):
+		case ok && receipt.AssetSHA256 != "":
+			return fmt.Errorf("%s %s: installed asset %s (%s) doesn't match locked asset %s (%s)", tool.Name, tool.Version, receipt.Asset, receipt.AssetSHA256, asset.Name, asset.SHA256)
+		default:
+			// the installed asset is unknown, it is downloaded again to check it and replaces the
+			// installed version only once verified
+			installFunc = installRelease
+		}
+	}
+	gologger.Info().Msgf("installing %s %s from lockfile...", tool.Name, tool.Version)
+	version, err := installFunc(tool, path)
+	if err != nil {
+		return err
+	}
+	gologger.Info().Msgf("installed %s %s (%s)", tool.Name, version, au.BrightGreen("locked").String())
+	return nil
+}
@@ -0,0 +1,106 @@
+// Package lockfile contains the crtm.lock format used to share the exact
+// tool releases of a team and to reproduce them with a frozen install.
+package lockfile
+
+import (
+	"bytes"
+	"os"
+	"sort"
+	"strings"
+
+	errorutil "github.com/projectdiscovery/utils/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// SchemaVersion is the latest lockfile format understood by crtm
+const SchemaVersion = 1
+
+// DefaultName is the name of the lockfile written by crtm lock
+const DefaultName = "crtm.lock"
+
+// Lockfile pins tools to a release and the sha256 of their assets
+type Lockfile struct {
+	Version int    `yaml:"version"`
+	Tools   []Tool `yaml:"tools"`
+}
+
+// Tool is a locked tool release, Assets are keyed by platform (os/arch)
+type Tool struct {
+	Name     string           `yaml:"name"`
+	Org      string           `yaml:"org"`
+	Repo     string           `yaml:"repo"`
+	Provider string           `yaml:"provider,omitempty"`
+	URL      string           `yaml:"url,omitempty"`
+	Version  string           `yaml:"version"`
+	Assets   map[string]Asset `yaml:"assets"`
+}
+
+// Asset is a release asset and its sha256
+type Asset struct {
+	Name   string `yaml:"name"`
+	SHA256 string `yaml:"sha256"`
+}
+
+// Platform returns the key of the assets of given os and arch
+func Platform(goos, goarch string) string {
+	return goos + "/" + goarch
+}
+
+// Read reads and validates the lockfile at path
+func Read(path string) (*Lockfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse parses and validates lockfile data
+func Parse(data []byte) (*Lockfile, error) {
+	l := &Lockfile{}
+	if err := yaml.Unmarshal(data, l); err != nil {
+		return nil, errorutil.NewWithErr(err).Msgf("failed to parse lockfile")
+	}
+	if l.Version == 0 {
+		return nil, errorutil.NewWithTag("lockfile", "missing lockfile version")
+	}
+	if l.Version > SchemaVersion {
+		return nil, errorutil.NewWithTag("lockfile", "lockfile version %d is not supported (max %d), please update crtm", l.Version, SchemaVersion)
+	}
+	for _, tool := range l.Tools {
+		if tool.Name == "" || tool.Version == "" {
+			return nil, errorutil.NewWithTag("lockfile", "tool entries need a name and a version")
+		}
+		for platform, asset := range tool.Assets {
+			if asset.Name == "" || asset.SHA256 == "" {
+				return nil, errorutil.NewWithTag("lockfile", "%s %s: asset of %s needs a name and a sha256", tool.Name, tool.Version, platform)
+			}
+		}
+	}
+	return l, nil
+}
+
+// Get returns the locked release of tool name
+func (l *Lockfile) Get(name string) (Tool, bool) {
+	for _, tool := range l.Tools {
+		if strings.EqualFold(tool.Name, name) {
+			return tool, true
+		}
+	}
+	return Tool{}, false
+}
+
+// Write writes the lockfile to path, tools are sorted by name for stable diffs
+func (l *Lockfile) Write(path string) error {
+	l.Version = SchemaVersion
+	sort.Slice(l.Tools, func(i, j int) bool {
+		return l.Tools[i].Name < l.Tools[j].Name
+	})
+	buf := &bytes.Buffer{}
+	encoder := yaml.NewEncoder(buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(l); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
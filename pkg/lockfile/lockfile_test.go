@@ -0,0 +1,43 @@
+package lockfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteRead(t *testing.T) {
+	dir, err := os.MkdirTemp("", "test-lockfile")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	lock := &Lockfile{Tools: []Tool{
+		{Name: "spray", Org: "chainreactors", Repo: "spray", Version: "1.0.0", Assets: map[string]Asset{
+			Platform("linux", "amd64"): {Name: "spray_linux_amd64", SHA256: "aa"},
+		}},
+		{Name: "gogo", Org: "chainreactors", Repo: "gogo", Version: "2.11.0", Assets: map[string]Asset{
+			Platform("windows", "amd64"): {Name: "gogo_windows_amd64.exe", SHA256: "bb"},
+		}},
+	}}
+	lockPath := filepath.Join(dir, DefaultName)
+	require.Nil(t, lock.Write(lockPath))
+
+	read, err := Read(lockPath)
+	require.Nil(t, err)
+	require.Equal(t, SchemaVersion, read.Version)
+	require.Equal(t, "gogo", read.Tools[0].Name)
+
+	gogo, ok := read.Get("GOGO")
+	require.True(t, ok)
+	require.Equal(t, "bb", gogo.Assets["windows/amd64"].SHA256)
+}
+
+func TestParseInvalid(t *testing.T) {
+	_, err := Parse([]byte("version: 99\ntools: []\n"))
+	require.NotNil(t, err)
+
+	_, err = Parse([]byte("version: 1\ntools:\n  - name: gogo\n    version: 1.0.0\n    assets:\n      linux/amd64:\n        name: gogo_linux_amd64\n"))
+	require.NotNil(t, err)
+}
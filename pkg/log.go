@@ -0,0 +1,42 @@
+package pkg
+
+import (
+	"sync"
+
+	"github.com/chainreactors/crtm/pkg/types"
+	"github.com/projectdiscovery/gologger"
+)
+
+var (
+	// loggers are the loggers set for tools, keyed by tool name
+	loggers sync.Map
+	// toolLocks serialize the operations on a tool, keyed by tool name
+	toolLocks sync.Map
+)
+
+// SetLogger sends the output of the operations on a tool to logger, nil restores the default logger.
+// Operations running concurrently on different tools use their own logger so that their output
+// doesn't interleave.
+func SetLogger(toolName string, logger *gologger.Logger) {
+	if logger == nil {
+		loggers.Delete(toolName)
+		return
+	}
+	loggers.Store(toolName, logger)
+}
+
+// logger returns the logger of the operations on tool
+func logger(tool types.Tool) *gologger.Logger {
+	if logger, ok := loggers.Load(tool.Name); ok {
+		return logger.(*gologger.Logger)
+	}
+	return gologger.DefaultLogger
+}
+
+// lockTool waits until no other operation runs on the tool, its version store and executable
+// in path are shared, and returns the function releasing it
+func lockTool(toolName string) func() {
+	lock, _ := toolLocks.LoadOrStore(toolName, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	return lock.(*sync.Mutex).Unlock
+}
@@ -0,0 +1,52 @@
+package pkg
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chainreactors/crtm/pkg/types"
+	"github.com/projectdiscovery/gologger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetLogger(t *testing.T) {
+	tool := types.Tool{Name: "gogo"}
+	require.Equal(t, gologger.DefaultLogger, logger(tool))
+
+	jobLogger := &gologger.Logger{}
+	SetLogger(tool.Name, jobLogger)
+	require.Equal(t, jobLogger, logger(tool))
+	require.Equal(t, gologger.DefaultLogger, logger(types.Tool{Name: "spray"}))
+
+	SetLogger(tool.Name, nil)
+	require.Equal(t, gologger.DefaultLogger, logger(tool))
+}
+
+func TestLockTool(t *testing.T) {
+	var mu sync.Mutex
+	var running, maxRunning int
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer lockTool("gogo")()
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+	}
+	// other tools aren't blocked
+	unlock := lockTool("spray")
+	unlock()
+	wg.Wait()
+	require.Equal(t, 1, maxRunning)
+}
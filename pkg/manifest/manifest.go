@@ -0,0 +1,61 @@
+// Package manifest contains the crtm.yaml format describing the tools an
+// engagement repo wants installed, crtm sync brings installed tools to it.
+package manifest
+
+import (
+	"os"
+
+	errorutil "github.com/projectdiscovery/utils/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// SchemaVersion is the latest manifest format understood by crtm
+const SchemaVersion = 1
+
+// DefaultName is the manifest read by crtm sync when none is given
+const DefaultName = "crtm.yaml"
+
+// Manifest lists the wanted tools, Prune removes installed tools that aren't listed
+type Manifest struct {
+	Version int    `yaml:"version"`
+	Prune   bool   `yaml:"prune,omitempty"`
+	Tools   []Tool `yaml:"tools"`
+}
+
+// Tool is a wanted tool, an empty version follows the latest release
+type Tool struct {
+	Name    string `yaml:"name"`
+	Version string `yaml:"version,omitempty"`
+}
+
+// Read reads and validates the manifest at path
+func Read(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse parses and validates manifest data
+func Parse(data []byte) (*Manifest, error) {
+	m := &Manifest{}
+	if err := yaml.Unmarshal(data, m); err != nil {
+		return nil, errorutil.NewWithErr(err).Msgf("failed to parse manifest")
+	}
+	if m.Version == 0 {
+		return nil, errorutil.NewWithTag("manifest", "missing manifest version")
+	}
+	if m.Version > SchemaVersion {
+		return nil, errorutil.NewWithTag("manifest", "manifest version %d is not supported (max %d), please update crtm", m.Version, SchemaVersion)
+	}
+	for i, tool := range m.Tools {
+		if tool.Name == "" {
+			return nil, errorutil.NewWithTag("manifest", "tool #%d has no name", i+1)
+		}
+		if tool.Version == "latest" {
+			m.Tools[i].Version = ""
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,27 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	m, err := Parse([]byte(`version: 1
+prune: true
+tools:
+  - name: gogo
+    version: 2.11.0
+  - name: spray
+    version: latest
+  - name: zombie
+`))
+	require.Nil(t, err)
+	require.True(t, m.Prune)
+	require.Len(t, m.Tools, 3)
+	require.Equal(t, "2.11.0", m.Tools[0].Version)
+	require.Empty(t, m.Tools[1].Version)
+
+	_, err = Parse([]byte("version: 1\ntools:\n  - version: 1.0.0\n"))
+	require.NotNil(t, err)
+}
@@ -0,0 +1,148 @@
+// Package mirror rewrites github api and download urls to mirrors for restricted networks.
+// Mirrors are tried in order and the original url is used last.
+package mirror
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/projectdiscovery/gologger"
+)
+
+// githubAPIHost is the host of the github api, replaced by the API base url of rules
+const githubAPIHost = "api.github.com"
+
+// downloadHosts serve github release assets, archives and raw files
+var downloadHosts = []string{
+	"github.com",
+	"objects.githubusercontent.com",
+	"release-assets.githubusercontent.com",
+	"codeload.github.com",
+	"raw.githubusercontent.com",
+}
+
+// Rule is a mirror of github.
+// API replaces the github api base url (https://api.github.com).
+// Download rewrites download urls, {url} is replaced with the original url and {path} with
+// its path. Without placeholder the original url is appended to it (ghproxy style prefix).
+// The Authorization header is only sent to the mirror if ForwardAuth is set.
+type Rule struct {
+	API         string `yaml:"api,omitempty"`
+	Download    string `yaml:"download,omitempty"`
+	ForwardAuth bool   `yaml:"forward_auth,omitempty"`
+}
+
+// Rules are the mirrors tried in order before the original url
+var Rules []Rule
+
+// Rewrite returns the mirror url of u, false if the rule doesn't apply to it
+func (r Rule) Rewrite(u *url.URL) (string, bool) {
+	host := strings.ToLower(u.Hostname())
+	switch {
+	case host == githubAPIHost && r.API != "":
+		return strings.TrimSuffix(r.API, "/") + u.RequestURI(), true
+	case isDownloadHost(host) && r.Download != "":
+		if strings.Contains(r.Download, "{url}") || strings.Contains(r.Download, "{path}") {
+			return strings.NewReplacer("{url}", u.String(), "{path}", strings.TrimPrefix(u.RequestURI(), "/")).Replace(r.Download), true
+		}
+		return r.Download + u.String(), true
+	}
+	return "", false
+}
+
+func isDownloadHost(host string) bool {
+	for _, downloadHost := range downloadHosts {
+		if host == downloadHost {
+			return true
+		}
+	}
+	return false
+}
+
+// Transport sends github requests to the mirrors of Rules in order, falling back to the next
+// mirror on network errors, server errors or rate limits and to the original url last.
+// Other responses of a mirror, such as 404, are returned as is.
+type Transport struct {
+	// Base is the transport used for requests, http.DefaultTransport if nil
+	Base http.RoundTripper
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// requests with a body can't be replayed
+	if len(Rules) == 0 || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		return t.base().RoundTrip(req)
+	}
+	for _, rule := range Rules {
+		mirrorURL, ok := rule.Rewrite(req.URL)
+		if !ok {
+			continue
+		}
+		mirrorReq, err := rewriteRequest(req, mirrorURL, rule.ForwardAuth)
+		if err != nil {
+			gologger.Verbose().Msgf("invalid mirror url %s: %s", mirrorURL, err)
+			continue
+		}
+		resp, err := t.base().RoundTrip(mirrorReq)
+		if err == nil && !unavailable(resp) {
+			return resp, nil
+		}
+		if err == nil {
+			resp.Body.Close()
+			err = fmt.Errorf("%s", resp.Status)
+		}
+		gologger.Verbose().Msgf("mirror %s failed: %s", mirrorReq.URL.Host, err)
+	}
+	return t.base().RoundTrip(req)
+}
+
+// unavailable reports whether a mirror response falls back to the next mirror: server errors and
+// rate limits, answered with 429 or with 403 and an exhausted github rate limit
+func unavailable(resp *http.Response) bool {
+	switch {
+	case resp.StatusCode >= http.StatusInternalServerError, resp.StatusCode == http.StatusTooManyRequests:
+		return true
+	case resp.StatusCode == http.StatusForbidden:
+		return resp.Header.Get("X-RateLimit-Remaining") == "0"
+	}
+	return false
+}
+
+func rewriteRequest(req *http.Request, rawURL string, forwardAuth bool) (*http.Request, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	mirrorReq := req.Clone(req.Context())
+	mirrorReq.URL = u
+	mirrorReq.Host = u.Host
+	if !forwardAuth {
+		mirrorReq.Header.Del("Authorization")
+	}
+	if req.GetBody != nil {
+		if mirrorReq.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return mirrorReq, nil
+}
+
+// ParseDownloadRules returns rules rewriting downloads to the given mirrors
+func ParseDownloadRules(mirrors []string) []Rule {
+	var rules []Rule
+	for _, m := range mirrors {
+		if m = strings.TrimSpace(m); m != "" {
+			rules = append(rules, Rule{Download: m})
+		}
+	}
+	return rules
+}
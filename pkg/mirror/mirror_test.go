@@ -0,0 +1,124 @@
+package mirror
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewrite(t *testing.T) {
+	asset, _ := url.Parse("https://github.com/chainreactors/gogo/releases/download/v2.11.0/gogo_linux_amd64")
+	api, _ := url.Parse("https://api.github.com/repos/chainreactors/gogo/releases/latest?per_page=1")
+	other, _ := url.Parse("https://gitlab.com/chainreactors/gogo")
+
+	tests := []struct {
+		rule     Rule
+		u        *url.URL
+		expected string
+	}{
+		{Rule{Download: "https://ghproxy.com/"}, asset, "https://ghproxy.com/https://github.com/chainreactors/gogo/releases/download/v2.11.0/gogo_linux_amd64"},
+		{Rule{Download: "https://mirror.local/gh?u={url}"}, asset, "https://mirror.local/gh?u=https://github.com/chainreactors/gogo/releases/download/v2.11.0/gogo_linux_amd64"},
+		{Rule{Download: "https://artifactory.local/github/{path}"}, asset, "https://artifactory.local/github/chainreactors/gogo/releases/download/v2.11.0/gogo_linux_amd64"},
+		{Rule{API: "https://ghapi.local/"}, api, "https://ghapi.local/repos/chainreactors/gogo/releases/latest?per_page=1"},
+	}
+	for _, test := range tests {
+		rewritten, ok := test.rule.Rewrite(test.u)
+		require.True(t, ok)
+		require.Equal(t, test.expected, rewritten)
+	}
+
+	_, ok := Rule{API: "https://ghapi.local"}.Rewrite(asset)
+	require.False(t, ok, "api rules don't apply to downloads")
+	_, ok = Rule{Download: "https://ghproxy.com/"}.Rewrite(api)
+	require.False(t, ok, "download rules don't apply to the api")
+	_, ok = Rule{Download: "https://ghproxy.com/"}.Rewrite(other)
+	require.False(t, ok, "rules only apply to github")
+}
+
+func TestTransportFallback(t *testing.T) {
+	var auths []string
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusBadGateway)
+	}))
+	defer broken.Close()
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auths = append(auths, r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+	defer working.Close()
+
+	defer func(rules []Rule) { Rules = rules }(Rules)
+	Rules = []Rule{
+		{Download: broken.URL + "/{path}"},
+		{API: "http://127.0.0.1:1"},
+		{Download: working.URL + "/{path}"},
+	}
+	client := &http.Client{Transport: &Transport{}}
+	req, err := http.NewRequest(http.MethodGet, "https://github.com/chainreactors/gogo/releases/download/v2.11.0/gogo_linux_amd64", nil)
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "token secret")
+	resp, err := client.Do(req)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Equal(t, "/chainreactors/gogo/releases/download/v2.11.0/gogo_linux_amd64", string(body))
+	require.Equal(t, []string{""}, auths, "the token must not be sent to mirrors")
+
+	Rules = []Rule{{Download: working.URL + "/{path}", ForwardAuth: true}}
+	resp, err = client.Do(req)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, "token secret", auths[1])
+}
+
+func TestTransportNotFound(t *testing.T) {
+	var requests int
+	missing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.NotFound(w, r)
+	}))
+	defer missing.Close()
+	limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	}))
+	defer limited.Close()
+
+	defer func(rules []Rule) { Rules = rules }(Rules)
+	Rules = []Rule{{API: limited.URL}, {API: missing.URL}, {API: "http://127.0.0.1:1"}}
+	// a 404 of a mirror is returned without trying the next mirrors or github
+	client := &http.Client{Transport: &Transport{}}
+	resp, err := client.Get("https://api.github.com/repos/chainreactors/gogo/releases/tags/v2.11.0")
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	require.Equal(t, 1, requests)
+
+	// github answers exhausted rate limits with 403
+	exhausted := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		http.Error(w, "rate limited", http.StatusForbidden)
+	}))
+	defer exhausted.Close()
+	forbidden := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer forbidden.Close()
+	Rules = []Rule{{API: exhausted.URL}, {API: missing.URL}}
+	resp, err = client.Get("https://api.github.com/repos/chainreactors/gogo/releases/tags/v2.11.0")
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	require.Equal(t, 2, requests)
+
+	Rules = []Rule{{API: forbidden.URL}, {API: missing.URL}}
+	resp, err = client.Get("https://api.github.com/repos/chainreactors/gogo/releases/tags/v2.11.0")
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusForbidden, resp.StatusCode, "a 403 without exhausted rate limit is returned as is")
+	require.Equal(t, 2, requests)
+}
@@ -63,6 +63,24 @@ func lookupConfFromShell() (*Config, error) {
 	return nil, errors.New("shell not supported")
 }
 
+// RCFile returns the rc file of the current shell where the binary path is exported, without creating it
+func RCFile() (string, error) {
+	shell := filepath.Base(os.Getenv("SHELL"))
+	if shell == "." {
+		shell = confList[0].shellName
+	}
+	for _, conf := range confList {
+		if conf.shellName == shell {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", err
+			}
+			return filepath.Join(home, conf.rcFile), nil
+		}
+	}
+	return "", fmt.Errorf("shell %s not supported", shell)
+}
+
 func isSet(path string) (bool, error) {
 	pathVars := paths()
 	return sliceutil.Contains(pathVars, path), nil
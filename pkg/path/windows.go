@@ -20,6 +20,11 @@ import (
 	"golang.org/x/sys/windows/registry"
 )
 
+// RCFile returns an empty path, PATH is stored in the registry on windows
+func RCFile() (string, error) {
+	return "", nil
+}
+
 func add(p string) (bool, error) {
 	cur, err := getPathsFromRegistry()
 	if nil != err {
@@ -0,0 +1,98 @@
+// Package plan computes the steps changing the installed tools, it is shared
+// by the install/update/remove flags and the desired state sync command.
+package plan
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/chainreactors/crtm/pkg/types"
+)
+
+// Action is the change a step applies to a tool
+type Action string
+
+const (
+	Install   Action = "install"
+	Update    Action = "update"
+	Downgrade Action = "downgrade"
+	Remove    Action = "remove"
+	Keep      Action = "keep"
+)
+
+// Step is an action on a tool, Installed is the version installed before the step
+type Step struct {
+	Action    Action
+	Tool      types.Tool
+	Installed string
+}
+
+// Plan is the ordered list of steps to apply
+type Plan []Step
+
+// String returns a one line description of the step
+func (s Step) String() string {
+	switch s.Action {
+	case Install:
+		return fmt.Sprintf("install %s %s", s.Tool.Name, s.Tool.Version)
+	case Update, Downgrade:
+		return fmt.Sprintf("%s %s %s -> %s", s.Action, s.Tool.Name, s.Installed, s.Tool.Version)
+	case Remove:
+		return fmt.Sprintf("remove %s %s", s.Tool.Name, s.Installed)
+	default:
+		return fmt.Sprintf("keep %s %s", s.Tool.Name, s.Installed)
+	}
+}
+
+// Changes returns true if applying the plan changes any tool
+func (p Plan) Changes() bool {
+	for _, step := range p {
+		if step.Action != Keep {
+			return true
+		}
+	}
+	return false
+}
+
+// Sync returns the plan bringing installed tools to the wanted releases. installed maps
+// tool names to their installed version, installed tools of prune that aren't wanted are removed.
+func Sync(wanted []types.Tool, installed map[string]string, prune []types.Tool) Plan {
+	var p Plan
+	isWanted := map[string]struct{}{}
+	for _, tool := range wanted {
+		isWanted[tool.Name] = struct{}{}
+		current, ok := installed[tool.Name]
+		p = append(p, Step{Action: action(current, tool.Version, ok), Tool: tool, Installed: current})
+	}
+	for _, tool := range prune {
+		if _, ok := isWanted[tool.Name]; ok {
+			continue
+		}
+		if current, ok := installed[tool.Name]; ok {
+			p = append(p, Step{Action: Remove, Tool: tool, Installed: current})
+		}
+	}
+	return p
+}
+
+func action(installed, wanted string, isInstalled bool) Action {
+	switch {
+	case !isInstalled:
+		return Install
+	case strings.EqualFold(installed, wanted):
+		return Keep
+	}
+	current, err := semver.NewVersion(installed)
+	if err != nil {
+		return Update
+	}
+	target, err := semver.NewVersion(wanted)
+	if err != nil {
+		return Update
+	}
+	if target.LessThan(current) {
+		return Downgrade
+	}
+	return Update
+}
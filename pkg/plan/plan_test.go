@@ -0,0 +1,36 @@
+package plan
+
+import (
+	"testing"
+
+	"github.com/chainreactors/crtm/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSync(t *testing.T) {
+	wanted := []types.Tool{
+		{Name: "gogo", Version: "2.11.0"},
+		{Name: "spray", Version: "1.0.0"},
+		{Name: "zombie", Version: "1.2.0"},
+		{Name: "urlfounder", Version: "0.1.0"},
+	}
+	installed := map[string]string{
+		"gogo":   "2.10.0",
+		"spray":  "1.1.0",
+		"zombie": "1.2.0",
+		"iom":    "0.0.1",
+	}
+	prune := []types.Tool{{Name: "gogo"}, {Name: "iom"}, {Name: "malice_network"}}
+
+	p := Sync(wanted, installed, prune)
+	var actions []Action
+	for _, step := range p {
+		actions = append(actions, step.Action)
+	}
+	require.Equal(t, []Action{Update, Downgrade, Keep, Install, Remove}, actions)
+	require.Equal(t, "update gogo 2.10.0 -> 2.11.0", p[0].String())
+	require.Equal(t, "remove iom 0.0.1", p[4].String())
+	require.True(t, p.Changes())
+
+	require.False(t, Sync(wanted[2:3], installed, nil).Changes())
+}
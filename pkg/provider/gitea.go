@@ -0,0 +1,117 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+type giteaRelease struct {
+	TagName    string `json:"tag_name"`
+	Body       string `json:"body"`
+	Draft      bool   `json:"draft"`
+	Prerelease bool   `json:"prerelease"`
+	ZipballURL string `json:"zipball_url"`
+	Assets     []struct {
+		ID                 int64  `json:"id"`
+		Name               string `json:"name"`
+		Size               int64  `json:"size"`
+		BrowserDownloadURL string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+type giteaProvider struct {
+	baseURL string
+}
+
+// NewGitea returns a provider for a gitea (or forgejo) instance, GITEA_TOKEN is used for authentication
+func NewGitea(baseURL string) Provider {
+	return &giteaProvider{baseURL: baseURL}
+}
+
+func (p *giteaProvider) Name() string {
+	return Gitea
+}
+
+func (p *giteaProvider) header() http.Header {
+	header := http.Header{}
+	header.Set("Accept", "application/json")
+	if token := os.Getenv("GITEA_TOKEN"); token != "" {
+		header.Set("Authorization", "token "+token)
+	}
+	return header
+}
+
+func (p *giteaProvider) endpoint(owner, repo, path string) string {
+	return fmt.Sprintf("%s/api/v1/repos/%s/%s/releases%s", p.baseURL, url.PathEscape(owner), url.PathEscape(repo), path)
+}
+
+func (p *giteaProvider) LatestRelease(ctx context.Context, owner, repo string) (*Release, error) {
+	var release giteaRelease
+	if err := getJSON(ctx, p.endpoint(owner, repo, "/latest"), p.header(), &release); err != nil {
+		return nil, err
+	}
+	return release.toRelease(), nil
+}
+
+func (p *giteaProvider) GetRelease(ctx context.Context, owner, repo, tag string) (*Release, error) {
+	var release giteaRelease
+	if err := getJSON(ctx, p.endpoint(owner, repo, "/tags/"+url.PathEscape(tag)), p.header(), &release); err != nil {
+		return nil, err
+	}
+	return release.toRelease(), nil
+}
+
+func (p *giteaProvider) ListReleases(ctx context.Context, owner, repo string) ([]*Release, error) {
+	var releases []*Release
+	for page := 1; ; page++ {
+		var list []giteaRelease
+		if err := getJSON(ctx, p.endpoint(owner, repo, fmt.Sprintf("?limit=50&page=%d", page)), p.header(), &list); err != nil {
+			return nil, err
+		}
+		for _, release := range list {
+			if release.Draft {
+				continue
+			}
+			releases = append(releases, release.toRelease())
+		}
+		if len(list) < 50 {
+			return releases, nil
+		}
+	}
+}
+
+func (p *giteaProvider) OpenAsset(ctx context.Context, owner, repo string, asset Asset) (io.ReadCloser, error) {
+	return download(ctx, asset.URL, p.header())
+}
+
+func (p *giteaProvider) AssetRequest(ctx context.Context, owner, repo string, asset Asset) (*http.Request, error) {
+	return newRequest(ctx, asset.URL, p.header())
+}
+
+func (r giteaRelease) toRelease() *Release {
+	release := &Release{Tag: r.TagName, Body: r.Body, Prerelease: r.Prerelease, SourceURL: r.ZipballURL}
+	for _, asset := range r.Assets {
+		release.Assets = append(release.Assets, Asset{
+			ID:   asset.ID,
+			Name: asset.Name,
+			URL:  asset.BrowserDownloadURL,
+			Size: asset.Size,
+		})
+	}
+	return release
+}
+
+// getJSON decodes the json response of url into v
+func getJSON(ctx context.Context, url string, header http.Header, v interface{}) error {
+	body, err := download(ctx, url, header)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return json.NewDecoder(body).Decode(v)
+}
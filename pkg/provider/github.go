@@ -0,0 +1,124 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/google/go-github/github"
+	"golang.org/x/oauth2"
+)
+
+// NewGithubClient returns a github api client authenticated with GITHUB_TOKEN if set,
+// baseURL is only required for github enterprise instances
+func NewGithubClient(baseURL string) (*github.Client, error) {
+	// go-github changes the redirect policy of its client while downloading assets,
+	// each github client gets its own copy of the shared client
+	shared := *HTTPClient
+	httpclient := &shared
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, httpclient)
+		httpclient = oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}))
+	}
+	if baseURL != "" {
+		return github.NewEnterpriseClient(baseURL, baseURL, httpclient)
+	}
+	return github.NewClient(httpclient), nil
+}
+
+type gitHubProvider struct {
+	client *github.Client
+}
+
+// NewGitHub returns a provider for github.com or a github enterprise instance
+func NewGitHub(baseURL string) (Provider, error) {
+	client, err := NewGithubClient(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	return &gitHubProvider{client: client}, nil
+}
+
+func (p *gitHubProvider) Name() string {
+	return GitHub
+}
+
+func (p *gitHubProvider) LatestRelease(ctx context.Context, owner, repo string) (*Release, error) {
+	release, _, err := p.client.Repositories.GetLatestRelease(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	return fromGitHubRelease(release), nil
+}
+
+func (p *gitHubProvider) GetRelease(ctx context.Context, owner, repo, tag string) (*Release, error) {
+	release, _, err := p.client.Repositories.GetReleaseByTag(ctx, owner, repo, tag)
+	if err != nil {
+		return nil, err
+	}
+	return fromGitHubRelease(release), nil
+}
+
+func (p *gitHubProvider) ListReleases(ctx context.Context, owner, repo string) ([]*Release, error) {
+	var releases []*Release
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := p.client.Repositories.ListReleases(ctx, owner, repo, opt)
+		if err != nil {
+			return nil, err
+		}
+		for _, release := range page {
+			if release.GetDraft() {
+				continue
+			}
+			releases = append(releases, fromGitHubRelease(release))
+		}
+		if resp.NextPage == 0 {
+			return releases, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+func (p *gitHubProvider) OpenAsset(ctx context.Context, owner, repo string, asset Asset) (io.ReadCloser, error) {
+	rc, rdurl, err := p.client.Repositories.DownloadReleaseAsset(ctx, owner, repo, asset.ID)
+	if err != nil {
+		return nil, err
+	}
+	if rc != nil {
+		return rc, nil
+	}
+	return download(ctx, rdurl, http.Header{})
+}
+
+// AssetRequest resolves the storage url the api redirects to, assets served by the api itself can't be ranged
+func (p *gitHubProvider) AssetRequest(ctx context.Context, owner, repo string, asset Asset) (*http.Request, error) {
+	rc, rdurl, err := p.client.Repositories.DownloadReleaseAsset(ctx, owner, repo, asset.ID)
+	if err != nil {
+		return nil, err
+	}
+	if rc != nil {
+		rc.Close()
+		return nil, ErrRangeNotSupported
+	}
+	return newRequest(ctx, rdurl, http.Header{})
+}
+
+func fromGitHubRelease(release *github.RepositoryRelease) *Release {
+	r := &Release{
+		Tag:        release.GetTagName(),
+		Body:       release.GetBody(),
+		Prerelease: release.GetPrerelease(),
+		SourceURL:  release.GetZipballURL(),
+	}
+	for _, asset := range release.Assets {
+		r.Assets = append(r.Assets, Asset{
+			ID:   asset.GetID(),
+			Name: asset.GetName(),
+			URL:  asset.GetBrowserDownloadURL(),
+			Size: int64(asset.GetSize()),
+		})
+	}
+	return r
+}
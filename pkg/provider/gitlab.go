@@ -0,0 +1,131 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+const defaultGitLabURL = "https://gitlab.com"
+
+type gitlabRelease struct {
+	TagName         string `json:"tag_name"`
+	Description     string `json:"description"`
+	UpcomingRelease bool   `json:"upcoming_release"`
+	Assets          struct {
+		Sources []struct {
+			Format string `json:"format"`
+			URL    string `json:"url"`
+		} `json:"sources"`
+		Links []struct {
+			ID             int64  `json:"id"`
+			Name           string `json:"name"`
+			URL            string `json:"url"`
+			DirectAssetURL string `json:"direct_asset_url"`
+		} `json:"links"`
+	} `json:"assets"`
+}
+
+type gitlabProvider struct {
+	baseURL string
+}
+
+// NewGitLab returns a provider for gitlab.com or a self-hosted instance, GITLAB_TOKEN is used for authentication
+func NewGitLab(baseURL string) Provider {
+	if baseURL == "" {
+		baseURL = defaultGitLabURL
+	}
+	return &gitlabProvider{baseURL: baseURL}
+}
+
+func (p *gitlabProvider) Name() string {
+	return GitLab
+}
+
+func (p *gitlabProvider) header() http.Header {
+	header := http.Header{}
+	if token := os.Getenv("GITLAB_TOKEN"); token != "" {
+		header.Set("PRIVATE-TOKEN", token)
+	}
+	return header
+}
+
+func (p *gitlabProvider) endpoint(owner, repo, path string) string {
+	project := repo
+	if owner != "" {
+		project = owner + "/" + repo
+	}
+	return fmt.Sprintf("%s/api/v4/projects/%s/releases%s", p.baseURL, url.PathEscape(project), path)
+}
+
+func (p *gitlabProvider) LatestRelease(ctx context.Context, owner, repo string) (*Release, error) {
+	releases, err := p.ListReleases(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	for _, release := range releases {
+		if !release.Prerelease {
+			return release, nil
+		}
+	}
+	return nil, errorutil.NewWithTag("gitlab", "no release found for %s/%s", owner, repo)
+}
+
+func (p *gitlabProvider) GetRelease(ctx context.Context, owner, repo, tag string) (*Release, error) {
+	var release gitlabRelease
+	if err := getJSON(ctx, p.endpoint(owner, repo, "/"+url.PathEscape(tag)), p.header(), &release); err != nil {
+		return nil, err
+	}
+	return release.toRelease(), nil
+}
+
+func (p *gitlabProvider) ListReleases(ctx context.Context, owner, repo string) ([]*Release, error) {
+	var releases []*Release
+	for page := 1; ; page++ {
+		var list []gitlabRelease
+		if err := getJSON(ctx, p.endpoint(owner, repo, fmt.Sprintf("?per_page=100&page=%d", page)), p.header(), &list); err != nil {
+			return nil, err
+		}
+		for _, release := range list {
+			// upcoming releases are scheduled for a later date, they aren't published yet
+			if release.UpcomingRelease {
+				continue
+			}
+			releases = append(releases, release.toRelease())
+		}
+		if len(list) < 100 {
+			return releases, nil
+		}
+	}
+}
+
+func (p *gitlabProvider) OpenAsset(ctx context.Context, owner, repo string, asset Asset) (io.ReadCloser, error) {
+	return download(ctx, asset.URL, p.header())
+}
+
+func (p *gitlabProvider) AssetRequest(ctx context.Context, owner, repo string, asset Asset) (*http.Request, error) {
+	return newRequest(ctx, asset.URL, p.header())
+}
+
+func (r gitlabRelease) toRelease() *Release {
+	// gitlab has no prerelease flag, prereleases are told by their tag
+	release := &Release{Tag: r.TagName, Body: r.Description, Prerelease: isPrerelease(r.TagName)}
+	for _, source := range r.Assets.Sources {
+		if source.Format == "zip" {
+			release.SourceURL = source.URL
+		}
+	}
+	for _, link := range r.Assets.Links {
+		assetURL := link.DirectAssetURL
+		if assetURL == "" {
+			assetURL = link.URL
+		}
+		release.Assets = append(release.Assets, Asset{ID: link.ID, Name: link.Name, URL: assetURL})
+	}
+	return release
+}
@@ -0,0 +1,155 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+var hrefRegex = regexp.MustCompile(`(?i)href="([^"?#]+)"`)
+
+type httpDirectoryProvider struct {
+	baseURL string
+}
+
+// NewHTTPDirectory returns a provider for a plain http directory listing laid out as
+// <url>/<owner>/<repo>/<tag>/<asset>, releases are sorted by semantic version
+func NewHTTPDirectory(baseURL string) Provider {
+	return &httpDirectoryProvider{baseURL: baseURL}
+}
+
+func (p *httpDirectoryProvider) Name() string {
+	return HTTP
+}
+
+func (p *httpDirectoryProvider) repoURL(owner, repo string) string {
+	if owner == "" {
+		return p.baseURL + "/" + url.PathEscape(repo) + "/"
+	}
+	return p.baseURL + "/" + url.PathEscape(owner) + "/" + url.PathEscape(repo) + "/"
+}
+
+func (p *httpDirectoryProvider) LatestRelease(ctx context.Context, owner, repo string) (*Release, error) {
+	tags, err := p.listTags(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		if !isPrerelease(tag) {
+			return p.GetRelease(ctx, owner, repo, tag)
+		}
+	}
+	return nil, errorutil.NewWithTag("http", "no release found in %s", p.repoURL(owner, repo))
+}
+
+func (p *httpDirectoryProvider) GetRelease(ctx context.Context, owner, repo, tag string) (*Release, error) {
+	releaseURL := p.repoURL(owner, repo) + url.PathEscape(tag) + "/"
+	entries, err := listDirectory(ctx, releaseURL)
+	if err != nil {
+		return nil, err
+	}
+	release := &Release{Tag: tag, Prerelease: isPrerelease(tag)}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry, "/") {
+			continue
+		}
+		release.Assets = append(release.Assets, Asset{
+			// directory listings have no ids, position is stable enough to identify an asset
+			ID:   int64(len(release.Assets) + 1),
+			Name: entry,
+			URL:  releaseURL + url.PathEscape(entry),
+		})
+	}
+	return release, nil
+}
+
+func (p *httpDirectoryProvider) ListReleases(ctx context.Context, owner, repo string) ([]*Release, error) {
+	tags, err := p.listTags(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	releases := make([]*Release, 0, len(tags))
+	for _, tag := range tags {
+		release, err := p.GetRelease(ctx, owner, repo, tag)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, release)
+	}
+	return releases, nil
+}
+
+func (p *httpDirectoryProvider) OpenAsset(ctx context.Context, owner, repo string, asset Asset) (io.ReadCloser, error) {
+	return download(ctx, asset.URL, http.Header{})
+}
+
+func (p *httpDirectoryProvider) AssetRequest(ctx context.Context, owner, repo string, asset Asset) (*http.Request, error) {
+	return newRequest(ctx, asset.URL, http.Header{})
+}
+
+// listTags returns tag directories of the repo sorted newest first
+func (p *httpDirectoryProvider) listTags(ctx context.Context, owner, repo string) ([]string, error) {
+	entries, err := listDirectory(ctx, p.repoURL(owner, repo))
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry, "/") {
+			tags = append(tags, strings.TrimSuffix(entry, "/"))
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		vi, erri := semver.NewVersion(tags[i])
+		vj, errj := semver.NewVersion(tags[j])
+		if erri != nil || errj != nil {
+			return erri == nil
+		}
+		return vi.GreaterThan(vj)
+	})
+	return tags, nil
+}
+
+// listDirectory returns the names linked from a directory index page, directories keep their trailing slash
+func listDirectory(ctx context.Context, dirURL string) ([]string, error) {
+	body, err := download(ctx, dirURL, http.Header{})
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]struct{}{}
+	var entries []string
+	for _, match := range hrefRegex.FindAllStringSubmatch(string(data), -1) {
+		href, err := url.PathUnescape(match[1])
+		if err != nil || strings.Contains(href, "://") || strings.HasPrefix(href, "/") || strings.HasPrefix(href, "..") {
+			continue
+		}
+		name := path.Base(strings.TrimSuffix(href, "/"))
+		if strings.HasSuffix(href, "/") {
+			name += "/"
+		}
+		if _, ok := seen[name]; ok || name == "./" {
+			continue
+		}
+		seen[name] = struct{}{}
+		entries = append(entries, name)
+	}
+	return entries, nil
+}
+
+func isPrerelease(tag string) bool {
+	v, err := semver.NewVersion(tag)
+	return err == nil && v.Prerelease() != ""
+}
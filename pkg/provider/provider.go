@@ -0,0 +1,105 @@
+// Package provider resolves tool releases from the forge or server they are published on
+package provider
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/chainreactors/crtm/pkg/httpclient"
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+// Kinds of supported release providers
+const (
+	GitHub = "github"
+	GitLab = "gitlab"
+	Gitea  = "gitea"
+	HTTP   = "http"
+)
+
+// HTTPClient is used by providers to talk to APIs and download assets
+var HTTPClient = httpclient.New()
+
+// Release is a provider agnostic release of a repo
+type Release struct {
+	Tag        string `json:"tag"`
+	Body       string `json:"body,omitempty"`
+	Prerelease bool   `json:"prerelease,omitempty"`
+	// SourceURL is the zip archive of the sources of the release, empty if the provider has none
+	SourceURL string  `json:"source_url,omitempty"`
+	Assets    []Asset `json:"assets"`
+}
+
+// Asset is a downloadable file attached to a release
+type Asset struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+	Size int64  `json:"size,omitempty"`
+}
+
+// GetAsset returns the release asset with given name
+func (r *Release) GetAsset(name string) (Asset, bool) {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset, true
+		}
+	}
+	return Asset{}, false
+}
+
+// Provider resolves releases of owner/repo and opens their assets
+type Provider interface {
+	// Name returns the kind of the provider
+	Name() string
+	// LatestRelease returns the latest stable release
+	LatestRelease(ctx context.Context, owner, repo string) (*Release, error)
+	// GetRelease returns the release with given tag
+	GetRelease(ctx context.Context, owner, repo, tag string) (*Release, error)
+	// ListReleases returns releases newest first, prereleases included
+	ListReleases(ctx context.Context, owner, repo string) ([]*Release, error)
+	// OpenAsset opens a stream of the asset content, caller must close it
+	OpenAsset(ctx context.Context, owner, repo string, asset Asset) (io.ReadCloser, error)
+}
+
+// New returns the provider of given kind, baseURL is optional for github and gitlab
+func New(kind, baseURL string) (Provider, error) {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	switch strings.ToLower(kind) {
+	case "", GitHub:
+		return NewGitHub(baseURL)
+	case GitLab:
+		return NewGitLab(baseURL), nil
+	case Gitea:
+		if baseURL == "" {
+			return nil, errorutil.NewWithTag("provider", "gitea provider requires an url")
+		}
+		return NewGitea(baseURL), nil
+	case HTTP:
+		if baseURL == "" {
+			return nil, errorutil.NewWithTag("provider", "http provider requires an url")
+		}
+		return NewHTTPDirectory(baseURL), nil
+	default:
+		return nil, errorutil.NewWithTag("provider", "unknown provider %s", kind)
+	}
+}
+
+// download performs a GET request and returns the body if status is 200
+func download(ctx context.Context, url string, header http.Header) (io.ReadCloser, error) {
+	req, err := newRequest(ctx, url, header)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		return nil, errorutil.NewWithErr(err).Msgf("failed to download %s", url)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errorutil.New("got %v while downloading %s, expected status 200", resp.StatusCode, url)
+	}
+	return resp.Body, nil
+}
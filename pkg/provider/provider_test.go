@@ -0,0 +1,151 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGiteaProvider(t *testing.T) {
+	mux := http.NewServeMux()
+	var server *httptest.Server
+	mux.HandleFunc("/api/v1/repos/team/gogo/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"tag_name": "v2.11.0", "assets": [{"id": 7, "name": "gogo_linux_amd64", "browser_download_url": "%s/dl/gogo_linux_amd64"}]}`, server.URL)
+	})
+	mux.HandleFunc("/dl/gogo_linux_amd64", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("binary"))
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	p, err := New(Gitea, server.URL)
+	require.Nil(t, err)
+	release, err := p.LatestRelease(context.Background(), "team", "gogo")
+	require.Nil(t, err)
+	require.Equal(t, "v2.11.0", release.Tag)
+
+	asset, ok := release.GetAsset("gogo_linux_amd64")
+	require.True(t, ok)
+	body, err := p.OpenAsset(context.Background(), "team", "gogo", asset)
+	require.Nil(t, err)
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	require.Nil(t, err)
+	require.Equal(t, "binary", string(data))
+}
+
+func TestHTTPDirectoryProvider(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tools/gogo/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<a href="../">../</a><a href="v2.9.0/">v2.9.0/</a><a href="v2.11.0/">v2.11.0/</a><a href="v2.12.0-beta/">v2.12.0-beta/</a>`))
+	})
+	mux.HandleFunc("/tools/gogo/v2.11.0/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<a href="gogo_linux_amd64">gogo_linux_amd64</a><a href="gogo_2.11.0_checksums.txt">checksums</a>`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	p, err := New(HTTP, server.URL+"/tools")
+	require.Nil(t, err)
+	release, err := p.LatestRelease(context.Background(), "", "gogo")
+	require.Nil(t, err)
+	require.Equal(t, "v2.11.0", release.Tag)
+	require.Len(t, release.Assets, 2)
+	require.Equal(t, server.URL+"/tools/gogo/v2.11.0/gogo_linux_amd64", release.Assets[0].URL)
+}
+
+func TestGitLabProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/v4/projects/tools%2Fgogo/releases", r.URL.EscapedPath())
+		_, _ = w.Write([]byte(`[
+			{"tag_name": "v2.12.0", "upcoming_release": true},
+			{"tag_name": "v2.12.0-rc.1"},
+			{"tag_name": "v2.11.0", "assets": {"sources": [{"format": "zip", "url": "https://gitlab.local/gogo.zip"}],
+				"links": [{"id": 1, "name": "gogo_linux_amd64", "url": "https://gitlab.local/gogo_linux_amd64"}]}}
+		]`))
+	}))
+	defer server.Close()
+
+	p, err := New(GitLab, server.URL)
+	require.Nil(t, err)
+	releases, err := p.ListReleases(context.Background(), "tools", "gogo")
+	require.Nil(t, err)
+	require.Len(t, releases, 2, "upcoming releases aren't published yet")
+	require.True(t, releases[0].Prerelease)
+	release, err := p.LatestRelease(context.Background(), "tools", "gogo")
+	require.Nil(t, err)
+	require.Equal(t, "v2.11.0", release.Tag)
+	require.Equal(t, "https://gitlab.local/gogo.zip", release.SourceURL)
+	require.Equal(t, "https://gitlab.local/gogo_linux_amd64", release.Assets[0].URL)
+}
+
+func TestUnknownProvider(t *testing.T) {
+	_, err := New("svn", "")
+	require.NotNil(t, err)
+	_, err = New(Gitea, "")
+	require.NotNil(t, err)
+}
+
+func TestOpenRange(t *testing.T) {
+	content := strings.Repeat("0123456789", 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "asset", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.Nil(t, err)
+
+	body, err := OpenRange(req, 90, -1)
+	require.Nil(t, err)
+	data, err := io.ReadAll(body)
+	body.Close()
+	require.Nil(t, err)
+	require.Equal(t, content[90:], string(data))
+	require.Equal(t, int64(90), body.Start)
+	require.Equal(t, int64(len(content)), body.Size)
+	require.True(t, body.Partial)
+
+	body, err = OpenRange(req, 10, 19)
+	require.Nil(t, err)
+	data, err = io.ReadAll(body)
+	body.Close()
+	require.Nil(t, err)
+	require.Equal(t, content[10:20], string(data))
+
+	_, err = OpenRange(req, 100, -1)
+	require.ErrorIs(t, err, ErrRangeNotSatisfiable)
+
+	// servers ignoring ranges send the whole content
+	ignoring := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(content))
+	}))
+	defer ignoring.Close()
+	req, err = http.NewRequest(http.MethodGet, ignoring.URL, nil)
+	require.Nil(t, err)
+	body, err = OpenRange(req, 90, -1)
+	require.Nil(t, err)
+	body.Close()
+	require.Equal(t, int64(0), body.Start)
+	require.False(t, body.Partial)
+}
+
+func TestParseContentRange(t *testing.T) {
+	start, size, ok := parseContentRange("bytes 10-19/100")
+	require.True(t, ok)
+	require.Equal(t, int64(10), start)
+	require.Equal(t, int64(100), size)
+
+	_, size, ok = parseContentRange("bytes 10-19/*")
+	require.True(t, ok)
+	require.Equal(t, int64(-1), size)
+
+	_, _, ok = parseContentRange("items 10-19/100")
+	require.False(t, ok)
+}
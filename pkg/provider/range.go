@@ -0,0 +1,110 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+var (
+	// ErrRangeNotSupported is returned by AssetRequest when the asset can only be opened as a whole
+	ErrRangeNotSupported = errorutil.NewWithTag("provider", "asset doesn't support range requests")
+	// ErrRangeNotSatisfiable is returned by OpenRange when the offset is at or after the end of the content
+	ErrRangeNotSatisfiable = errorutil.NewWithTag("provider", "requested range not satisfiable")
+)
+
+// AssetRequester is implemented by providers serving assets over plain http, the request it returns
+// is sent with a Range header to resume interrupted downloads or fetch large assets in segments
+type AssetRequester interface {
+	// AssetRequest returns the GET request of the asset content
+	AssetRequest(ctx context.Context, owner, repo string, asset Asset) (*http.Request, error)
+}
+
+// RangeBody is the content of a range request
+type RangeBody struct {
+	io.ReadCloser
+	// Start is the offset of the first byte of the body, 0 when the server ignored the range
+	Start int64
+	// Size is the size of the whole content, -1 when unknown
+	Size int64
+	// Partial is set when the server honored the range
+	Partial bool
+}
+
+// OpenRange sends req for the bytes from offset to end included, end -1 reads to the end of the content
+func OpenRange(req *http.Request, offset, end int64) (*RangeBody, error) {
+	req = req.Clone(req.Context())
+	if end < 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	} else {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, end))
+	}
+	// offsets are in the content as stored, it must not be compressed on the fly
+	req.Header.Set("Accept-Encoding", "identity")
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		return nil, errorutil.NewWithErr(err).Msgf("failed to download %s", req.URL)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return &RangeBody{ReadCloser: resp.Body, Size: resp.ContentLength}, nil
+	case http.StatusPartialContent:
+		start, size, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok {
+			resp.Body.Close()
+			return nil, errorutil.New("invalid content range %q while downloading %s", resp.Header.Get("Content-Range"), req.URL)
+		}
+		return &RangeBody{ReadCloser: resp.Body, Start: start, Size: size, Partial: true}, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		resp.Body.Close()
+		return nil, ErrRangeNotSatisfiable
+	default:
+		resp.Body.Close()
+		return nil, errorutil.New("got %v while downloading %s, expected status 200 or 206", resp.StatusCode, req.URL)
+	}
+}
+
+// parseContentRange returns the start and the complete length, -1 when unknown, of a "bytes start-end/length" header
+func parseContentRange(value string) (int64, int64, bool) {
+	value, ok := strings.CutPrefix(value, "bytes ")
+	if !ok {
+		return 0, 0, false
+	}
+	byteRange, length, ok := strings.Cut(value, "/")
+	if !ok {
+		return 0, 0, false
+	}
+	first, _, ok := strings.Cut(byteRange, "-")
+	if !ok {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if length == "*" {
+		return start, -1, true
+	}
+	size, err := strconv.ParseInt(length, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, size, true
+}
+
+// newRequest returns a GET request of url with given header
+func newRequest(ctx context.Context, url string, header http.Header) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	return req, nil
+}
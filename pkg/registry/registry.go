@@ -0,0 +1,177 @@
+// Package registry contains the declarative list of tools managed by crtm.
+// A default registry is embedded in the binary and user/team override files
+// are merged on top of it by tool name.
+package registry
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/chainreactors/crtm/pkg/provider"
+	"github.com/chainreactors/crtm/pkg/signature"
+	"github.com/chainreactors/crtm/pkg/types"
+	errorutil "github.com/projectdiscovery/utils/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// SchemaVersion is the latest registry format understood by crtm
+const SchemaVersion = 1
+
+//go:embed registry.yaml
+var defaultRegistry []byte
+
+// Registry is a versioned list of tool entries
+type Registry struct {
+	Version int     `yaml:"version" json:"version"`
+	Tools   []Entry `yaml:"tools" json:"tools"`
+}
+
+// Entry describes a single tool and where its releases are published.
+// Provider is the kind of server hosting the releases (github, gitlab, gitea or http)
+// and defaults to github, URL is the base url of the provider instance.
+// PublicKeys are the keys whose signature of the release checksums file is required.
+type Entry struct {
+	Name         string                  `yaml:"name" json:"name"`
+	Repo         string                  `yaml:"repo" json:"repo"`
+	Org          string                  `yaml:"org" json:"org"`
+	Provider     string                  `yaml:"provider,omitempty" json:"provider,omitempty"`
+	URL          string                  `yaml:"url,omitempty" json:"url,omitempty"`
+	Aliases      []string                `yaml:"aliases,omitempty" json:"aliases,omitempty"`
+	Description  string                  `yaml:"description,omitempty" json:"description,omitempty"`
+	AssetPattern string                  `yaml:"asset_pattern,omitempty" json:"asset_pattern,omitempty"`
+	PublicKeys   []string                `yaml:"public_keys,omitempty" json:"public_keys,omitempty"`
+	Requirements []types.ToolRequirement `yaml:"requirements,omitempty" json:"requirements,omitempty"`
+	// Disabled removes an entry defined by a previously loaded registry
+	Disabled bool `yaml:"disabled,omitempty" json:"disabled,omitempty"`
+}
+
+// Default returns the registry embedded in crtm
+func Default() *Registry {
+	r, err := Parse(defaultRegistry)
+	if err != nil {
+		// embedded registry is validated by tests, this can't happen in a release build
+		panic(err)
+	}
+	return r
+}
+
+// Parse parses registry data in yaml or json format
+func Parse(data []byte) (*Registry, error) {
+	r := &Registry{}
+	if err := yaml.Unmarshal(data, r); err != nil {
+		return nil, errorutil.NewWithErr(err).Msgf("failed to parse registry")
+	}
+	if r.Version == 0 {
+		return nil, errorutil.NewWithTag("registry", "missing registry version")
+	}
+	if r.Version > SchemaVersion {
+		return nil, errorutil.NewWithTag("registry", "registry version %d is not supported (max %d), please update crtm", r.Version, SchemaVersion)
+	}
+	for i := range r.Tools {
+		entry := &r.Tools[i]
+		if entry.Name == "" {
+			return nil, errorutil.NewWithTag("registry", "tool #%d has no name", i+1)
+		}
+		if entry.Repo == "" {
+			entry.Repo = entry.Name
+		}
+		if _, err := provider.New(entry.Provider, entry.URL); err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name, err)
+		}
+		if _, err := signature.ParseKeys(entry.PublicKeys); err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name, err)
+		}
+	}
+	return r, nil
+}
+
+// Load returns the default registry merged with the given override files.
+// Files that don't exist are skipped.
+func Load(paths ...string) (*Registry, error) {
+	r := Default()
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		override, err := Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		r.Merge(override)
+	}
+	return r, nil
+}
+
+// Merge adds or replaces entries of r with the ones in override
+func (r *Registry) Merge(override *Registry) {
+	for _, entry := range override.Tools {
+		i := r.index(entry.Name)
+		switch {
+		case entry.Disabled && i >= 0:
+			r.Tools = append(r.Tools[:i], r.Tools[i+1:]...)
+		case entry.Disabled:
+		case i >= 0:
+			r.Tools[i] = entry
+		default:
+			r.Tools = append(r.Tools, entry)
+		}
+	}
+}
+
+// Get returns the entry matching given name or alias
+func (r *Registry) Get(name string) (Entry, bool) {
+	for _, entry := range r.Tools {
+		if entry.Matches(name) {
+			return entry, true
+		}
+	}
+	return Entry{}, false
+}
+
+func (r *Registry) index(name string) int {
+	for i, entry := range r.Tools {
+		if strings.EqualFold(entry.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Matches returns true if name is the entry name or one of its aliases
+func (e Entry) Matches(name string) bool {
+	if strings.EqualFold(e.Name, name) {
+		return true
+	}
+	for _, alias := range e.Aliases {
+		if strings.EqualFold(alias, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tool returns the tool described by this entry without release information
+func (e Entry) Tool() types.Tool {
+	return types.Tool{
+		Name:         e.Name,
+		Repo:         e.Repo,
+		Org:          e.Org,
+		Provider:     e.Provider,
+		ProviderURL:  e.URL,
+		Aliases:      e.Aliases,
+		Description:  e.Description,
+		AssetPattern: e.AssetPattern,
+		PublicKeys:   e.PublicKeys,
+		Requirements: e.Requirements,
+		InstallType:  types.Binary,
+	}
+}
@@ -0,0 +1,65 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultRegistry(t *testing.T) {
+	r := Default()
+	require.Equal(t, SchemaVersion, r.Version)
+	require.NotEmpty(t, r.Tools)
+
+	entry, ok := r.Get("malice-network")
+	require.True(t, ok)
+	require.Equal(t, "malice_network", entry.Name)
+	require.Equal(t, "malice-network", entry.Repo)
+}
+
+func TestLoadOverride(t *testing.T) {
+	dir, err := os.MkdirTemp("", "test-registry")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	override := filepath.Join(dir, "registry.yaml")
+	data := []byte(`version: 1
+tools:
+  - name: gogo
+    repo: gogo
+    org: example
+  - name: zombie
+    disabled: true
+  - name: newtool
+    aliases: [nt]
+`)
+	require.Nil(t, os.WriteFile(override, data, 0644))
+
+	r, err := Load(override, filepath.Join(dir, "missing.yaml"))
+	require.Nil(t, err)
+
+	gogo, ok := r.Get("gogo")
+	require.True(t, ok)
+	require.Equal(t, "example", gogo.Org)
+
+	_, ok = r.Get("zombie")
+	require.False(t, ok)
+
+	newtool, ok := r.Get("nt")
+	require.True(t, ok)
+	require.Equal(t, "newtool", newtool.Repo)
+}
+
+func TestParseJSON(t *testing.T) {
+	r, err := Parse([]byte(`{"version": 1, "tools": [{"name": "spray", "org": "chainreactors"}]}`))
+	require.Nil(t, err)
+	require.Len(t, r.Tools, 1)
+	require.Equal(t, "spray", r.Tools[0].Repo)
+}
+
+func TestParseUnsupportedVersion(t *testing.T) {
+	_, err := Parse([]byte("version: 99\ntools: []\n"))
+	require.NotNil(t, err)
+}
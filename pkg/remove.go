@@ -3,24 +3,52 @@ package pkg
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	ospath "github.com/chainreactors/crtm/pkg/path"
+	"github.com/chainreactors/crtm/pkg/state"
+	"github.com/chainreactors/crtm/pkg/store"
 	"github.com/chainreactors/crtm/pkg/types"
-
-	"github.com/projectdiscovery/gologger"
 )
 
-// Remove removes given tool
+// Remove removes given tool from path. Its installed versions and receipts are removed, even if the
+// executable was already deleted from path, unless the tool is still linked from another binary path.
 func Remove(path string, tool types.Tool) error {
+	defer lockTool(tool.Name)()
+	s, err := state.Load()
+	if err != nil {
+		return err
+	}
 	executablePath, exists := ospath.GetExecutablePath(path, tool.Name)
+	if !exists && len(s.Versions(tool.Name)) == 0 {
+		return fmt.Errorf(types.ErrToolNotFound, tool.Name, executablePath)
+	}
+	logger(tool).Info().Msgf("removing %s...", tool.Name)
 	if exists {
-		gologger.Info().Msgf("removing %s...", tool.Name)
-		err := os.Remove(executablePath)
-		if err != nil {
+		if err := os.Remove(executablePath); err != nil {
 			return err
 		}
-		gologger.Info().Msgf("removed %s", tool.Name)
+	}
+	if err := store.Unlink(path, tool.Name); err != nil {
+		return err
+	}
+	links, err := store.Links(tool.Name)
+	if err != nil {
+		return err
+	}
+	if len(links) > 0 {
+		logger(tool).Info().Msgf("removed %s, its versions are kept for %s", tool.Name, strings.Join(links, ", "))
+		return nil
+	}
+	if err := store.Remove(tool.Name); err != nil {
+		return err
+	}
+	if err := state.Update(func(s *state.State) error {
+		s.Delete(tool.Name)
 		return nil
+	}); err != nil {
+		return err
 	}
-	return fmt.Errorf(types.ErrToolNotFound, tool.Name, executablePath)
+	logger(tool).Info().Msgf("removed %s", tool.Name)
+	return nil
 }
@@ -0,0 +1,25 @@
+package pkg
+
+import (
+	"fmt"
+
+	ospath "github.com/chainreactors/crtm/pkg/path"
+	"github.com/chainreactors/crtm/pkg/store"
+	"github.com/chainreactors/crtm/pkg/types"
+)
+
+// Rollback restores the version of a tool that was active before the current one
+func Rollback(path string, tool types.Tool) error {
+	defer lockTool(tool.Name)()
+	executablePath, exists := ospath.GetExecutablePath(path, tool.Name)
+	if !exists {
+		return fmt.Errorf(types.ErrToolNotFound, tool.Name, executablePath)
+	}
+	current, _ := store.Active(path, tool.Name)
+	previous, err := store.Rollback(path, tool.Name)
+	if err != nil {
+		return err
+	}
+	logger(tool).Info().Msgf("rolled back %s %s -> %s", tool.Name, current, previous)
+	return nil
+}
@@ -0,0 +1,99 @@
+// Package signature verifies detached signatures of release checksums files
+// with pinned public keys. minisign keys are supported, the Key interface
+// leaves room for other schemes such as cosign.
+package signature
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+
+	"aead.dev/minisign"
+)
+
+// Ext is the extension of the signature asset of a signed file
+const Ext = ".minisig"
+
+var (
+	ErrUnsigned     = errors.New("release is not signed")
+	ErrBadSignature = errors.New("signature doesn't match any trusted key")
+	// AllowUnsigned installs releases with a missing or bad signature
+	AllowUnsigned = false
+)
+
+//go:embed trusted_keys.txt
+var trustedKeys string
+
+// Trusted are the keys shipped with crtm, they are trusted for every tool
+var Trusted = func() []Key {
+	keys, err := ParseKeys(strings.Split(trustedKeys, "\n"))
+	if err != nil {
+		// embedded keys are validated by tests, this can't happen in a release build
+		panic(err)
+	}
+	return keys
+}()
+
+// Key is a public key verifying detached signatures
+type Key interface {
+	Verify(message, signature []byte) bool
+	String() string
+}
+
+type minisignKey struct {
+	key minisign.PublicKey
+}
+
+func (k minisignKey) Verify(message, signature []byte) bool {
+	return minisign.Verify(k.key, message, signature)
+}
+
+func (k minisignKey) String() string {
+	return "minisign:" + k.key.String()
+}
+
+// ParseKey parses a public key, the key type prefix defaults to minisign
+func ParseKey(key string) (Key, error) {
+	kind, value, ok := strings.Cut(strings.TrimSpace(key), ":")
+	if !ok {
+		kind, value = "minisign", kind
+	}
+	switch kind {
+	case "minisign":
+		var k minisign.PublicKey
+		if err := k.UnmarshalText([]byte(value)); err != nil {
+			return nil, fmt.Errorf("invalid minisign key %q: %w", value, err)
+		}
+		return minisignKey{key: k}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", kind)
+	}
+}
+
+// ParseKeys parses public keys, empty lines and comments are skipped
+func ParseKeys(keys []string) ([]Key, error) {
+	var parsed []Key
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" || strings.HasPrefix(key, "#") {
+			continue
+		}
+		k, err := ParseKey(key)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, k)
+	}
+	return parsed, nil
+}
+
+// Verify returns nil if signature of message is valid for any of the keys
+func Verify(keys []Key, message, signature []byte) error {
+	for _, key := range keys {
+		if key.Verify(message, signature) {
+			return nil
+		}
+	}
+	return ErrBadSignature
+}
@@ -0,0 +1,37 @@
+package signature
+
+import (
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"aead.dev/minisign"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrustedKeys(t *testing.T) {
+	_, err := ParseKeys(strings.Split(trustedKeys, "\n"))
+	require.Nil(t, err)
+}
+
+func TestVerify(t *testing.T) {
+	public, private, err := minisign.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	message := []byte("aaaa  gogo_1.0.0_linux_amd64.tar.gz\n")
+	sig := minisign.Sign(private, message)
+
+	keys, err := ParseKeys([]string{"# comment", "", public.String()})
+	require.Nil(t, err)
+	require.Len(t, keys, 1)
+	require.Nil(t, Verify(keys, message, sig))
+	require.ErrorIs(t, Verify(keys, []byte("tampered"), sig), ErrBadSignature)
+
+	prefixed, err := ParseKey("minisign:" + public.String())
+	require.Nil(t, err)
+	require.Equal(t, keys[0].String(), prefixed.String())
+
+	_, err = ParseKey("cosign:key")
+	require.NotNil(t, err)
+	_, err = ParseKey("RWnotakey")
+	require.NotNil(t, err)
+}
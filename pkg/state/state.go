@@ -0,0 +1,207 @@
+// Package state records what crtm installed in a schema versioned state file.
+// Every installed tool version has a receipt describing where it came from and
+// the sha256 of the files extracted from its release asset.
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+// SchemaVersion is the latest state file format understood by crtm
+const SchemaVersion = 1
+
+// Path is the location of the state file
+var Path = func() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "crtm", "state.json")
+	}
+	return filepath.Join(home, ".crtm", "state.json")
+}()
+
+// mutex serializes read-modify-write cycles of the state file within crtm
+var mutex sync.Mutex
+
+// State is the content of the state file
+type State struct {
+	SchemaVersion int `json:"schema_version"`
+	// Tools contains receipts keyed by tool name then version
+	Tools map[string]map[string]*Receipt `json:"tools"`
+}
+
+// Receipt describes an installed tool version
+type Receipt struct {
+	Tool     string `json:"tool"`
+	Version  string `json:"version"`
+	Provider string `json:"provider,omitempty"`
+	// Repo is the source repo in org/repo format
+	Repo    string `json:"repo"`
+	Asset   string `json:"asset,omitempty"`
+	AssetID int64  `json:"asset_id,omitempty"`
+	// AssetSHA256 is the sha256 of the downloaded release asset
+	AssetSHA256 string `json:"asset_sha256,omitempty"`
+	// Files maps the installed files, relative to the version directory, to their sha256
+	Files       map[string]string `json:"files"`
+	Channel     string            `json:"channel,omitempty"`
+	Pinned      bool              `json:"pinned,omitempty"`
+	InstalledAt time.Time         `json:"installed_at"`
+}
+
+// Load reads the state file, an empty state is returned if it doesn't exist yet
+func Load() (*State, error) {
+	s := &State{SchemaVersion: SchemaVersion, Tools: map[string]map[string]*Receipt{}}
+	data, err := os.ReadFile(Path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, errorutil.NewWithErr(err).Msgf("failed to parse state file %s", Path)
+	}
+	if s.SchemaVersion > SchemaVersion {
+		return nil, errorutil.NewWithTag("state", "state file %s was written by a newer crtm (schema %d), please update crtm", Path, s.SchemaVersion)
+	}
+	s.SchemaVersion = SchemaVersion
+	if s.Tools == nil {
+		s.Tools = map[string]map[string]*Receipt{}
+	}
+	return s, nil
+}
+
+// Save writes the state file atomically
+func (s *State) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(Path, data, 0644)
+}
+
+// Update loads the state, applies fn and saves the result
+func Update(fn func(s *State) error) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	s, err := Load()
+	if err != nil {
+		return err
+	}
+	if err := fn(s); err != nil {
+		return err
+	}
+	return s.Save()
+}
+
+// Receipt returns the receipt of a tool version
+func (s *State) Receipt(tool, version string) (*Receipt, bool) {
+	receipt, ok := s.Tools[tool][version]
+	return receipt, ok
+}
+
+// Versions returns the receipts of every installed version of a tool
+func (s *State) Versions(tool string) map[string]*Receipt {
+	return s.Tools[tool]
+}
+
+// Put adds or replaces a receipt
+func (s *State) Put(receipt *Receipt) {
+	if s.Tools[receipt.Tool] == nil {
+		s.Tools[receipt.Tool] = map[string]*Receipt{}
+	}
+	s.Tools[receipt.Tool][receipt.Version] = receipt
+}
+
+// Delete removes the receipts of all versions of a tool
+func (s *State) Delete(tool string) {
+	delete(s.Tools, tool)
+}
+
+// Retain removes the receipts of tool versions not in versions
+func (s *State) Retain(tool string, versions []string) {
+	keep := map[string]struct{}{}
+	for _, version := range versions {
+		keep[version] = struct{}{}
+	}
+	for version := range s.Tools[tool] {
+		if _, ok := keep[version]; !ok {
+			delete(s.Tools[tool], version)
+		}
+	}
+	if len(s.Tools[tool]) == 0 {
+		delete(s.Tools, tool)
+	}
+}
+
+// HashFiles returns the sha256 of every regular file in dir keyed by its slash separated relative path
+func HashFiles(dir string) (map[string]string, error) {
+	hashes := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		hash, err := HashFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hashes[filepath.ToSlash(rel)] = hash
+		return nil
+	})
+	return hashes, err
+}
+
+// HashFile returns the hex encoded sha256 of a file
+func HashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// WriteFileAtomic writes data to a temporary file in the same directory, syncs it and renames it to path
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,55 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateAndLoad(t *testing.T) {
+	tmp, err := os.MkdirTemp("", "test-state")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	Path = filepath.Join(tmp, "state.json")
+
+	s, err := Load()
+	require.Nil(t, err)
+	require.Empty(t, s.Tools)
+
+	for _, version := range []string{"2.10.0", "2.11.0"} {
+		err = Update(func(s *State) error {
+			s.Put(&Receipt{Tool: "gogo", Version: version, Repo: "chainreactors/gogo"})
+			return nil
+		})
+		require.Nil(t, err)
+	}
+
+	s, err = Load()
+	require.Nil(t, err)
+	require.Equal(t, SchemaVersion, s.SchemaVersion)
+	require.Len(t, s.Versions("gogo"), 2)
+
+	s.Retain("gogo", []string{"2.11.0"})
+	_, ok := s.Receipt("gogo", "2.10.0")
+	require.False(t, ok)
+	receipt, ok := s.Receipt("gogo", "2.11.0")
+	require.True(t, ok)
+	require.Equal(t, "chainreactors/gogo", receipt.Repo)
+
+	require.Nil(t, os.WriteFile(Path, []byte(`{"schema_version": 99}`), 0644))
+	_, err = Load()
+	require.NotNil(t, err)
+}
+
+func TestHashFiles(t *testing.T) {
+	tmp, err := os.MkdirTemp("", "test-state")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	require.Nil(t, os.WriteFile(filepath.Join(tmp, "gogo"), []byte("gogo"), 0755))
+
+	hashes, err := HashFiles(tmp)
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"gogo": "16af0577252ea2fc2b73260d8fe6a4e73155e9f83bb234588b561ab01c9bca6b"}, hashes)
+}
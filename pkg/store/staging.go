@@ -0,0 +1,89 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// stagingPrefix prefixes the directories versions are extracted to before they are committed,
+// they are ignored by Versions
+const stagingPrefix = ".staging-"
+
+// staleStaging is the age after which a staging directory left by an interrupted install is removed
+var staleStaging = time.Hour
+
+// Stage returns a new staging directory for a version of tool. Files are written to it then
+// Commit moves it to the store at once, so that an interrupted install never leaves a partial version.
+func Stage(tool string) (string, error) {
+	if err := os.MkdirAll(ToolDir(tool), os.ModePerm); err != nil {
+		return "", err
+	}
+	removeStaleStaging(tool)
+	return os.MkdirTemp(ToolDir(tool), stagingPrefix+"*")
+}
+
+// Commit syncs the files of a staging directory to disk and renames it to the version directory,
+// replacing a version directory left incomplete by older crtm releases
+func Commit(stagingDir, tool, version string) error {
+	entries, err := os.ReadDir(stagingDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			if err := syncPath(filepath.Join(stagingDir, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	if err := syncPath(stagingDir); err != nil {
+		return err
+	}
+	versionDir := VersionDir(tool, version)
+	if err := os.RemoveAll(versionDir); err != nil {
+		return err
+	}
+	if err := os.Rename(stagingDir, versionDir); err != nil {
+		return err
+	}
+	return syncPath(ToolDir(tool))
+}
+
+// Discard removes a staging directory
+func Discard(stagingDir string) {
+	_ = os.RemoveAll(stagingDir)
+}
+
+func removeStaleStaging(tool string) {
+	entries, err := os.ReadDir(ToolDir(tool))
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), stagingPrefix) {
+			continue
+		}
+		if info, err := entry.Info(); err == nil && time.Since(info.ModTime()) > staleStaging {
+			_ = os.RemoveAll(filepath.Join(ToolDir(tool), entry.Name()))
+		}
+	}
+}
+
+// syncPath flushes a file or directory to disk, directories can't be synced on windows
+func syncPath(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := f.Sync(); err != nil {
+		if info, statErr := f.Stat(); runtime.GOOS == "windows" && statErr == nil && info.IsDir() {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
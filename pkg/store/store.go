@@ -0,0 +1,390 @@
+// Package store keeps installed tool versions side by side and switches the active one
+// by pointing the executable in the binary path to one of them.
+//
+// Layout: <Root>/<tool>/<version>/<tool>[.exe]
+//
+// Every activation is recorded as a generation in <Root>/<tool>/history.json so that
+// a tool can be rolled back to the version it replaced, and the binary paths it is activated
+// in are recorded in <Root>/<tool>/links.json so that its versions are kept while still linked.
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	ospath "github.com/chainreactors/crtm/pkg/path"
+	"github.com/chainreactors/crtm/pkg/state"
+)
+
+// historyFile records the activated versions of a tool, oldest first
+const historyFile = "history.json"
+
+// linksFile records the binary paths a tool is activated in
+const linksFile = "links.json"
+
+// Root is the directory holding installed tool versions
+var Root = func() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "crtm", "versions")
+	}
+	return filepath.Join(home, ".crtm", "versions")
+}()
+
+// Generations is the number of previously active versions kept in the store when pruning
+var Generations = 3
+
+var (
+	// ErrVersionNotInstalled is returned when switching to a version missing from the store
+	ErrVersionNotInstalled = errors.New("version not installed")
+	// ErrNoPreviousVersion is returned when rolling back a tool without previous generation
+	ErrNoPreviousVersion = errors.New("no previous version to roll back to")
+)
+
+// Generation is an activated version of a tool
+type Generation struct {
+	Version     string    `json:"version"`
+	ActivatedAt time.Time `json:"activated_at"`
+}
+
+// ToolDir returns the directory holding all versions of a tool
+func ToolDir(tool string) string {
+	return filepath.Join(Root, tool)
+}
+
+// VersionDir returns the directory holding a single version of a tool
+func VersionDir(tool, version string) string {
+	return filepath.Join(Root, tool, version)
+}
+
+// Executable returns the path of the tool executable for given version
+func Executable(tool, version string) (string, bool) {
+	return ospath.GetExecutablePath(VersionDir(tool, version), tool)
+}
+
+// Versions returns the installed versions of a tool, newest first
+func Versions(tool string) ([]string, error) {
+	entries, err := os.ReadDir(ToolDir(tool))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), stagingPrefix) {
+			continue
+		}
+		if _, ok := Executable(tool, entry.Name()); ok {
+			versions = append(versions, entry.Name())
+		}
+	}
+	SortVersions(versions)
+	return versions, nil
+}
+
+// SortVersions sorts versions newest first, versions that are not semver are sorted last
+func SortVersions(versions []string) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		vi, erri := semver.NewVersion(versions[i])
+		vj, errj := semver.NewVersion(versions[j])
+		if erri != nil || errj != nil {
+			if erri == nil || errj == nil {
+				return erri == nil
+			}
+			return versions[i] > versions[j]
+		}
+		return vi.GreaterThan(vj)
+	})
+}
+
+// Activate points the tool executable in binPath to given installed version and records it as the latest generation.
+// A symlink is used when supported, otherwise the executable is copied.
+func Activate(binPath, tool, version string) error {
+	if err := link(binPath, tool, version); err != nil {
+		return err
+	}
+	if err := addLink(binPath, tool); err != nil {
+		return err
+	}
+	history, err := History(tool)
+	if err != nil {
+		return err
+	}
+	history = append(removeVersion(history, version), Generation{Version: version, ActivatedAt: time.Now()})
+	return writeHistory(tool, history)
+}
+
+// Rollback activates the version that was active before the current one and returns it
+func Rollback(binPath, tool string) (string, error) {
+	history, err := History(tool)
+	if err != nil {
+		return "", err
+	}
+	for i := len(history) - 2; i >= 0; i-- {
+		version := history[i].Version
+		if _, ok := Executable(tool, version); !ok {
+			continue
+		}
+		if err := link(binPath, tool, version); err != nil {
+			return "", err
+		}
+		return version, writeHistory(tool, history[:i+1])
+	}
+	return "", fmt.Errorf("%s: %w", tool, ErrNoPreviousVersion)
+}
+
+// Adopt moves an executable installed outside of the store (by older crtm releases) into the store
+// so that it is kept as a previous generation when the tool is updated
+func Adopt(binPath, executablePath, tool, version string) error {
+	dir := VersionDir(tool, version)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	target := filepath.Join(dir, filepath.Base(executablePath))
+	if err := os.Rename(executablePath, target); err != nil {
+		// binary path and store may be on different filesystems
+		if err := copyFile(executablePath, target); err != nil {
+			return err
+		}
+	}
+	return Activate(binPath, tool, version)
+}
+
+// Active returns the version the executable in binPath points to
+func Active(binPath, tool string) (string, bool) {
+	executablePath, exists := ospath.GetExecutablePath(binPath, tool)
+	if !exists {
+		return "", false
+	}
+	if target, err := os.Readlink(executablePath); err == nil {
+		rel, err := filepath.Rel(ToolDir(tool), target)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return "", false
+		}
+		return filepath.Dir(rel), true
+	}
+	// copied executables are identified by the latest generation
+	history, err := History(tool)
+	if err != nil || len(history) == 0 {
+		return "", false
+	}
+	return history[len(history)-1].Version, true
+}
+
+// History returns the generations of a tool, oldest first
+func History(tool string) ([]Generation, error) {
+	data, err := os.ReadFile(filepath.Join(ToolDir(tool), historyFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var history []Generation
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// Prune removes versions of a tool that are neither active nor one of the last Generations generations,
+// the active version, the latest generation, and the versions active in other binary paths are kept
+// whatever the value of Generations
+func Prune(tool string) error {
+	history, err := History(tool)
+	if err != nil || len(history) == 0 {
+		return err
+	}
+	generations := Generations
+	if generations < 0 {
+		generations = 0
+	}
+	if len(history) > generations+1 {
+		history = history[len(history)-generations-1:]
+	}
+	keep := map[string]struct{}{}
+	for _, generation := range history {
+		keep[generation.Version] = struct{}{}
+	}
+	links, err := Links(tool)
+	if err != nil {
+		return err
+	}
+	for _, binPath := range links {
+		if version, ok := Active(binPath, tool); ok {
+			keep[version] = struct{}{}
+		}
+	}
+	versions, err := Versions(tool)
+	if err != nil {
+		return err
+	}
+	for _, version := range versions {
+		if _, ok := keep[version]; ok {
+			continue
+		}
+		if err := os.RemoveAll(VersionDir(tool, version)); err != nil {
+			return err
+		}
+	}
+	return writeHistory(tool, history)
+}
+
+// link points the executable in binPath to the installed version
+func link(binPath, tool, version string) error {
+	target, ok := Executable(tool, version)
+	if !ok {
+		return fmt.Errorf("%s %s: %w", tool, version, ErrVersionNotInstalled)
+	}
+	if err := os.MkdirAll(binPath, os.ModePerm); err != nil {
+		return err
+	}
+	linkPath := filepath.Join(binPath, filepath.Base(target))
+	tmp := linkPath + ".crtm-tmp"
+	_ = os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		// filesystems without symlink support get a copy of the executable
+		if err := copyFile(target, tmp); err != nil {
+			_ = os.Remove(tmp)
+			return err
+		}
+	}
+	// rename replaces the previous executable atomically
+	if err := os.Rename(tmp, linkPath); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return syncPath(binPath)
+}
+
+func writeHistory(tool string, history []Generation) error {
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+	return state.WriteFileAtomic(filepath.Join(ToolDir(tool), historyFile), data, 0644)
+}
+
+func removeVersion(history []Generation, version string) []Generation {
+	filtered := history[:0]
+	for _, generation := range history {
+		if generation.Version != version {
+			filtered = append(filtered, generation)
+		}
+	}
+	return filtered
+}
+
+// Remove deletes all installed versions of a tool
+func Remove(tool string) error {
+	return os.RemoveAll(ToolDir(tool))
+}
+
+// Links returns the binary paths the tool is activated in whose executable still points to the store
+func Links(tool string) ([]string, error) {
+	recorded, err := readLinks(tool)
+	if err != nil {
+		return nil, err
+	}
+	var links []string
+	for _, binPath := range recorded {
+		if _, ok := Active(binPath, tool); ok {
+			links = append(links, binPath)
+		}
+	}
+	return links, nil
+}
+
+// Unlink forgets binPath as a binary path the tool is activated in, the executable is removed by the caller
+func Unlink(binPath, tool string) error {
+	links, err := readLinks(tool)
+	if err != nil {
+		return err
+	}
+	binPath = cleanBinPath(binPath)
+	filtered := links[:0]
+	for _, link := range links {
+		if link != binPath {
+			filtered = append(filtered, link)
+		}
+	}
+	if len(filtered) == len(links) {
+		return nil
+	}
+	return writeLinks(tool, filtered)
+}
+
+func addLink(binPath, tool string) error {
+	links, err := readLinks(tool)
+	if err != nil {
+		return err
+	}
+	binPath = cleanBinPath(binPath)
+	for _, link := range links {
+		if link == binPath {
+			return nil
+		}
+	}
+	return writeLinks(tool, append(links, binPath))
+}
+
+func readLinks(tool string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(ToolDir(tool), linksFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var links []string
+	if err := json.Unmarshal(data, &links); err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+func writeLinks(tool string, links []string) error {
+	data, err := json.MarshalIndent(links, "", "  ")
+	if err != nil {
+		return err
+	}
+	return state.WriteFileAtomic(filepath.Join(ToolDir(tool), linksFile), data, 0644)
+}
+
+func cleanBinPath(binPath string) string {
+	if abs, err := filepath.Abs(binPath); err == nil {
+		return abs
+	}
+	return filepath.Clean(binPath)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,185 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func installFakeVersion(t *testing.T, tool, version string) {
+	dir := VersionDir(tool, version)
+	require.Nil(t, os.MkdirAll(dir, os.ModePerm))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, tool), []byte(version), 0755))
+}
+
+func TestActivate(t *testing.T) {
+	tmp, err := os.MkdirTemp("", "test-store")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	Root = filepath.Join(tmp, "versions")
+	binPath := filepath.Join(tmp, "bin")
+
+	installFakeVersion(t, "gogo", "2.10.0")
+	installFakeVersion(t, "gogo", "2.11.0")
+
+	versions, err := Versions("gogo")
+	require.Nil(t, err)
+	require.Equal(t, []string{"2.11.0", "2.10.0"}, versions)
+
+	require.Nil(t, Activate(binPath, "gogo", "2.11.0"))
+	active, ok := Active(binPath, "gogo")
+	require.True(t, ok)
+	require.Equal(t, "2.11.0", active)
+
+	require.Nil(t, Activate(binPath, "gogo", "2.10.0"))
+	active, ok = Active(binPath, "gogo")
+	require.True(t, ok)
+	require.Equal(t, "2.10.0", active)
+	data, err := os.ReadFile(filepath.Join(binPath, "gogo"))
+	require.Nil(t, err)
+	require.Equal(t, "2.10.0", string(data))
+
+	err = Activate(binPath, "gogo", "1.0.0")
+	require.ErrorIs(t, err, ErrVersionNotInstalled)
+}
+
+func TestRollbackAndPrune(t *testing.T) {
+	tmp, err := os.MkdirTemp("", "test-store")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	Root = filepath.Join(tmp, "versions")
+	binPath := filepath.Join(tmp, "bin")
+
+	_, err = Rollback(binPath, "spray")
+	require.ErrorIs(t, err, ErrNoPreviousVersion)
+
+	for _, version := range []string{"1.0.0", "1.1.0", "1.2.0", "1.3.0"} {
+		installFakeVersion(t, "spray", version)
+		require.Nil(t, Activate(binPath, "spray", version))
+	}
+
+	defer func(generations int) { Generations = generations }(Generations)
+	Generations = 1
+	require.Nil(t, Prune("spray"))
+	versions, err := Versions("spray")
+	require.Nil(t, err)
+	require.Equal(t, []string{"1.3.0", "1.2.0"}, versions)
+
+	previous, err := Rollback(binPath, "spray")
+	require.Nil(t, err)
+	require.Equal(t, "1.2.0", previous)
+	active, ok := Active(binPath, "spray")
+	require.True(t, ok)
+	require.Equal(t, "1.2.0", active)
+
+	_, err = Rollback(binPath, "spray")
+	require.ErrorIs(t, err, ErrNoPreviousVersion)
+
+	// the active version is never pruned
+	installFakeVersion(t, "spray", "1.3.0")
+	require.Nil(t, Activate(binPath, "spray", "1.3.0"))
+	Generations = -1
+	require.Nil(t, Prune("spray"))
+	versions, err = Versions("spray")
+	require.Nil(t, err)
+	require.Equal(t, []string{"1.3.0"}, versions)
+	active, ok = Active(binPath, "spray")
+	require.True(t, ok)
+	require.Equal(t, "1.3.0", active)
+}
+
+func TestStageAndCommit(t *testing.T) {
+	tmp, err := os.MkdirTemp("", "test-store")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	Root = filepath.Join(tmp, "versions")
+
+	// a version extracted to a staging directory isn't installed until committed
+	stagingDir, err := Stage("zombie")
+	require.Nil(t, err)
+	require.Nil(t, os.WriteFile(filepath.Join(stagingDir, "zombie"), []byte("1.2.0"), 0755))
+	versions, err := Versions("zombie")
+	require.Nil(t, err)
+	require.Empty(t, versions)
+
+	require.Nil(t, Commit(stagingDir, "zombie", "1.2.0"))
+	versions, err = Versions("zombie")
+	require.Nil(t, err)
+	require.Equal(t, []string{"1.2.0"}, versions)
+	_, err = os.Stat(stagingDir)
+	require.True(t, os.IsNotExist(err))
+
+	// discarded and stale staging directories are removed
+	stagingDir, err = Stage("zombie")
+	require.Nil(t, err)
+	Discard(stagingDir)
+	_, err = os.Stat(stagingDir)
+	require.True(t, os.IsNotExist(err))
+
+	stale, err := Stage("zombie")
+	require.Nil(t, err)
+	old := time.Now().Add(-2 * staleStaging)
+	require.Nil(t, os.Chtimes(stale, old, old))
+	_, err = Stage("zombie")
+	require.Nil(t, err)
+	_, err = os.Stat(stale)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestLinks(t *testing.T) {
+	tmp, err := os.MkdirTemp("", "test-store")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	Root = filepath.Join(tmp, "versions")
+	binPath, otherPath := filepath.Join(tmp, "bin"), filepath.Join(tmp, "other")
+
+	installFakeVersion(t, "gogo", "2.11.0")
+	require.Nil(t, Activate(binPath, "gogo", "2.11.0"))
+	require.Nil(t, Activate(otherPath, "gogo", "2.11.0"))
+	require.Nil(t, Activate(binPath, "gogo", "2.11.0"))
+	links, err := Links("gogo")
+	require.Nil(t, err)
+	require.Equal(t, []string{binPath, otherPath}, links)
+
+	// a binary path whose executable was deleted or unlinked doesn't use the store anymore
+	require.Nil(t, os.Remove(filepath.Join(otherPath, "gogo")))
+	require.Nil(t, os.Remove(filepath.Join(binPath, "gogo")))
+	require.Nil(t, Unlink(binPath, "gogo"))
+	links, err = Links("gogo")
+	require.Nil(t, err)
+	require.Empty(t, links)
+}
+
+func TestPruneLinked(t *testing.T) {
+	tmp, err := os.MkdirTemp("", "test-store")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+	Root = filepath.Join(tmp, "versions")
+	defer func(generations int) { Generations = generations }(Generations)
+	Generations = 0
+	binPath, otherPath := filepath.Join(tmp, "bin"), filepath.Join(tmp, "other")
+
+	for _, version := range []string{"2.10.0", "2.11.0"} {
+		installFakeVersion(t, "gogo", version)
+	}
+	require.Nil(t, Activate(otherPath, "gogo", "2.10.0"))
+	require.Nil(t, Activate(binPath, "gogo", "2.11.0"))
+
+	// the version active in another binary path is kept
+	require.Nil(t, Prune("gogo"))
+	versions, err := Versions("gogo")
+	require.Nil(t, err)
+	require.Equal(t, []string{"2.11.0", "2.10.0"}, versions)
+	version, ok := Active(otherPath, "gogo")
+	require.True(t, ok)
+	require.Equal(t, "2.10.0", version)
+
+	require.Nil(t, Activate(otherPath, "gogo", "2.11.0"))
+	require.Nil(t, Prune("gogo"))
+	versions, err = Versions("gogo")
+	require.Nil(t, err)
+	require.Equal(t, []string{"2.11.0"}, versions)
+}
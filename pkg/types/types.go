@@ -1,25 +1,84 @@
 package types
 
-import "errors"
+import (
+	"errors"
+	"strings"
+)
 
 const Organization = "chainreactors"
 
 var (
 	ErrIsInstalled = errors.New("already installed")
 	ErrIsUpToDate  = errors.New("already up to date")
+	ErrNoChecksum  = errors.New("no checksum published in the release")
+	// ErrOutsideConstraint is returned when installing or updating a tool whose version constraint no release satisfies
+	ErrOutsideConstraint = errors.New("no release satisfies the version constraint")
 
 	ErrNoAssetFound = "could not find release asset for your platform (%s/%s)"
 	ErrToolNotFound = "%s: tool not found in path %s: skipping, please install first"
 )
 
 type Tool struct {
-	Name          string            `json:"name"`
-	Repo          string            `json:"repo"`
-	Version       string            `json:"version"`
-	GoInstallPath string            `json:"go_install_path" yaml:"go_install_path"`
-	Requirements  []ToolRequirement `json:"requirements"`
-	Assets        map[string]int64  `json:"assets"`
-	InstallType   InstallType       `json:"install_type" yaml:"install_type"`
+	Name          string   `json:"name"`
+	Repo          string   `json:"repo"`
+	Org           string   `json:"org"`
+	Provider      string   `json:"provider,omitempty"`
+	ProviderURL   string   `json:"provider_url,omitempty" yaml:"provider_url"`
+	Aliases       []string `json:"aliases,omitempty"`
+	Description   string   `json:"description,omitempty"`
+	AssetPattern  string   `json:"asset_pattern,omitempty" yaml:"asset_pattern"`
+	PublicKeys    []string `json:"public_keys,omitempty" yaml:"public_keys"`
+	Version       string   `json:"version"`
+	Pinned        bool     `json:"pinned,omitempty"`
+	Constraint    string   `json:"constraint,omitempty"`
+	LatestVersion string   `json:"latest_version,omitempty" yaml:"latest_version"`
+	// OutsideConstraint is set when no release satisfies the version constraint, Version is the latest release
+	OutsideConstraint bool              `json:"outside_constraint,omitempty" yaml:"outside_constraint"`
+	Channel           string            `json:"channel,omitempty"`
+	ReleaseChannel    string            `json:"release_channel,omitempty" yaml:"release_channel"`
+	GoInstallPath     string            `json:"go_install_path" yaml:"go_install_path"`
+	Requirements      []ToolRequirement `json:"requirements"`
+	Assets            map[string]int64  `json:"assets"`
+	AssetURLs         map[string]string `json:"asset_urls,omitempty" yaml:"asset_urls"`
+	Checksums         map[string]string `json:"checksums,omitempty"`
+	InstallType       InstallType       `json:"install_type" yaml:"install_type"`
+}
+
+// GetOrg returns the organization owning the tool repo, defaulting to Organization on github.
+// Other providers have no default, their repos may live at the root of the server.
+func (t Tool) GetOrg() string {
+	if t.Org == "" && (t.Provider == "" || strings.EqualFold(t.Provider, "github")) {
+		return Organization
+	}
+	return t.Org
+}
+
+// RepoPath returns the org/repo path of the tool repo, the repo alone when it has no org
+func (t Tool) RepoPath() string {
+	if org := t.GetOrg(); org != "" {
+		return org + "/" + t.Repo
+	}
+	return t.Repo
+}
+
+// VersionLabel returns the label shown next to the version being installed
+func (t Tool) VersionLabel() string {
+	switch {
+	case t.Pinned:
+		return "pinned"
+	case t.NewerOutsideConstraint() != "":
+		return t.Constraint
+	default:
+		return "latest"
+	}
+}
+
+// NewerOutsideConstraint returns the latest release version if it is excluded by the tool version constraint
+func (t Tool) NewerOutsideConstraint() string {
+	if t.Constraint == "" || t.LatestVersion == "" || t.LatestVersion == t.Version {
+		return ""
+	}
+	return t.LatestVersion
 }
 
 type InstallType string
@@ -2,13 +2,14 @@ package pkg
 
 import (
 	"fmt"
-	"github.com/chainreactors/crtm/pkg/update"
 	"github.com/chainreactors/crtm/pkg/utils"
 	"os"
 	"path/filepath"
 	"strings"
 
 	ospath "github.com/chainreactors/crtm/pkg/path"
+	"github.com/chainreactors/crtm/pkg/state"
+	"github.com/chainreactors/crtm/pkg/store"
 	"github.com/chainreactors/crtm/pkg/types"
 	"github.com/chainreactors/crtm/pkg/version"
 	"github.com/charmbracelet/glamour"
@@ -17,28 +18,43 @@ import (
 
 // Update updates a given tool
 func Update(path string, tool types.Tool, disableChangeLog bool) error {
+	defer lockTool(tool.Name)()
 	if executablePath, exists := ospath.GetExecutablePath(path, tool.Name); exists {
 		if isUpToDate(tool, path) {
 			return types.ErrIsUpToDate
 		}
-		gologger.Info().Msgf("updating %s...", tool.Name)
+		if err := checkConstraint(tool); err != nil {
+			return err
+		}
+		logger(tool).Info().Msgf("updating %s...", tool.Name)
 
 		if len(tool.Assets) == 0 {
 			return fmt.Errorf(types.ErrNoAssetFound, tool.Name, executablePath)
 		}
 
-		if err := os.Remove(executablePath); err != nil {
-			return err
+		// keep binaries installed before the version store existed as a previous generation
+		if _, ok := store.Active(path, tool.Name); !ok {
+			if v, err := version.ExtractInstalledVersion(tool, path); err == nil {
+				adopted := types.Tool{Name: tool.Name, Repo: tool.Repo, Org: tool.Org, Provider: tool.Provider, Version: v}
+				if err := store.Adopt(path, executablePath, tool.Name, v); err != nil {
+					logger(tool).Warning().Msgf("%s: could not keep installed version %s: %s", tool.Name, v, err)
+				} else if err := ensureReceipt(adopted); err != nil {
+					logger(tool).Warning().Msgf("%s: could not record installed version %s: %s", tool.Name, v, err)
+				}
+			}
 		}
 
 		ver, err := install(tool, path)
 		if err != nil {
 			return err
 		}
+		if err := prune(tool); err != nil {
+			logger(tool).Warning().Msgf("%s: could not prune old versions: %s", tool.Name, err)
+		}
 		if !disableChangeLog {
-			showReleaseNotes(tool.Repo)
+			showReleaseNotes(tool)
 		}
-		gologger.Info().Msgf("updated %s to %s (%s)", tool.Name, ver, au.BrightGreen("latest").String())
+		logger(tool).Info().Msgf("updated %s to %s (%s)", tool.Name, ver, au.BrightGreen(tool.VersionLabel()).String())
 		return nil
 	} else {
 		return fmt.Errorf(types.ErrToolNotFound, tool.Name, executablePath)
@@ -46,28 +62,43 @@ func Update(path string, tool types.Tool, disableChangeLog bool) error {
 }
 
 func isUpToDate(tool types.Tool, path string) bool {
-	v, err := version.ExtractInstalledVersion(tool, path)
+	v, err := utils.GetInstalledVersion(tool, path)
 	return err == nil && strings.EqualFold(tool.Version, v)
 }
 
-func showReleaseNotes(toolname string) {
-	gh, err := update.NewghReleaseDownloader(toolname)
+// prune removes old versions of tool from the store and their receipts
+func prune(tool types.Tool) error {
+	if err := store.Prune(tool.Name); err != nil {
+		return err
+	}
+	versions, err := store.Versions(tool.Name)
+	if err != nil {
+		return err
+	}
+	return state.Update(func(s *state.State) error {
+		s.Retain(tool.Name, versions)
+		return nil
+	})
+}
+
+func showReleaseNotes(tool types.Tool) {
+	release, err := utils.FetchRelease(tool, tool.Version)
 	if err != nil {
-		gologger.Fatal().Label("updater").Msgf("failed to download latest release got %v", err)
+		logger(tool).Error().Msgf("failed to fetch release notes of %s: %v", tool.Name, err)
+		return
 	}
-	gh.SetToolName(toolname)
-	output := gh.Latest.GetBody()
+	output := release.Body
 	// adjust colors for both dark / light terminal themes
 	r, err := glamour.NewTermRenderer(glamour.WithAutoStyle())
 	if err != nil {
-		gologger.Error().Msgf("markdown rendering not supported: %v", err)
+		logger(tool).Error().Msgf("markdown rendering not supported: %v", err)
 	}
 	if rendered, err := r.Render(output); err == nil {
 		output = rendered
 	} else {
-		gologger.Error().Msg(err.Error())
+		logger(tool).Error().Msg(err.Error())
 	}
-	gologger.Print().Msgf("%v\n", output)
+	logger(tool).Print().Msgf("%v\n", output)
 }
 
 // GetVersionCheckCallback returns a callback function and when it is executed returns a version string of that tool
@@ -0,0 +1,46 @@
+package update
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+// Asset is a downloaded asset kept in a temporary file so that it is never held in memory,
+// Close removes the file
+type Asset struct {
+	*os.File
+	SHA256 string
+	Size   int64
+}
+
+// Close closes and removes the temporary file
+func (a *Asset) Close() error {
+	_ = a.File.Close()
+	return os.Remove(a.Name())
+}
+
+// DownloadToFile streams data to a temporary file while computing its sha256,
+// the returned asset is positioned at its start
+func DownloadToFile(data io.Reader) (*Asset, error) {
+	f, err := os.CreateTemp("", "crtm-download-*")
+	if err != nil {
+		return nil, errorutil.NewWithErr(err).Msgf("failed to create temporary file")
+	}
+	asset := &Asset{File: f}
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, hasher), data)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = asset.Close()
+		return nil, errorutil.NewWithErr(err).Msgf("failed to write %v", f.Name())
+	}
+	asset.SHA256 = hex.EncodeToString(hasher.Sum(nil))
+	asset.Size = size
+	return asset, nil
+}
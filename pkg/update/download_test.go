@@ -0,0 +1,81 @@
+package update
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/chainreactors/crtm/pkg/provider"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadToFile(t *testing.T) {
+	data := strings.Repeat("crtm", 1<<16)
+	asset, err := DownloadToFile(strings.NewReader(data))
+	require.Nil(t, err)
+
+	sum := sha256.Sum256([]byte(data))
+	require.Equal(t, hex.EncodeToString(sum[:]), asset.SHA256)
+	require.Equal(t, int64(len(data)), asset.Size)
+	got, err := io.ReadAll(asset)
+	require.Nil(t, err)
+	require.Equal(t, data, string(got))
+
+	require.Nil(t, asset.Close())
+	_, err = os.Stat(asset.Name())
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestReleaseDownloader(t *testing.T) {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	w, err := zw.Create("crtm")
+	require.Nil(t, err)
+	_, _ = w.Write([]byte("crtm 1.1.0"))
+	require.Nil(t, zw.Close())
+	goos := runtime.GOOS
+	if goos == "darwin" {
+		goos = "macOS"
+	}
+	assetName := fmt.Sprintf("crtm_1.1.0_%s_%s.zip", goos, runtime.GOARCH)
+	sum := sha256.Sum256(buf.Bytes())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/chainreactors/crtm/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<a href="v1.0.0/">v1.0.0/</a><a href="v1.1.0/">v1.1.0/</a>`))
+	})
+	mux.HandleFunc("/chainreactors/crtm/v1.1.0/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `<a href="%s">asset</a><a href="crtm_1.1.0_checksums.txt">checksums</a>`, assetName)
+	})
+	mux.HandleFunc("/chainreactors/crtm/v1.1.0/"+assetName, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(buf.Bytes())
+	})
+	mux.HandleFunc("/chainreactors/crtm/v1.1.0/crtm_1.1.0_checksums.txt", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s  %s\n", hex.EncodeToString(sum[:]), assetName)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	HideProgressBar = true
+	gh, err := NewReleaseDownloader(provider.NewHTTPDirectory(server.URL), "crtm")
+	require.Nil(t, err)
+	require.Equal(t, "v1.1.0", gh.Latest.Tag)
+	bin, err := gh.GetExecutableFromAsset()
+	require.Nil(t, err)
+	defer bin.Close()
+	data, err := io.ReadAll(bin)
+	require.Nil(t, err)
+	require.Equal(t, "crtm 1.1.0", string(data))
+
+	err = gh.DownloadSourceWithCallback(false, nil)
+	require.ErrorContains(t, err, "no source archive")
+}
@@ -1,25 +1,19 @@
 package update
 
 import (
-	"archive/tar"
-	"archive/zip"
-	"bytes"
-	"compress/gzip"
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"io"
 	"io/fs"
 	"net/http"
-	"os"
 	"runtime"
 	"strings"
 
+	"github.com/chainreactors/crtm/pkg/extract"
+	"github.com/chainreactors/crtm/pkg/httpclient"
+	"github.com/chainreactors/crtm/pkg/provider"
 	"github.com/cheggaaa/pb/v3"
-	"github.com/google/go-github/v30/github"
 	"github.com/projectdiscovery/gologger"
 	errorutil "github.com/projectdiscovery/utils/errors"
-	"golang.org/x/oauth2"
 )
 
 var (
@@ -32,7 +26,7 @@ var (
 // is not nil furthur processing of asset file is stopped
 type AssetFileCallback func(path string, fileInfo fs.FileInfo, data io.Reader) error
 
-// GHReleaseDownloader fetches and reads release of a gh repo
+// GHReleaseDownloader fetches and reads release of a repo from its release provider, github by default
 type GHReleaseDownloader struct {
 	assetName     string // required assetName given as input
 	repoName      string // we assume toolname and repoName are always same
@@ -40,13 +34,22 @@ type GHReleaseDownloader struct {
 	organization  string // organization name of repo
 	Format        AssetFormat
 	AssetID       int
-	Latest        *github.RepositoryRelease
-	client        *github.Client
+	Latest        *provider.Release
+	provider      provider.Provider
 	httpClient    *http.Client
 }
 
-// NewghReleaseDownloader returns GHRD instance
+// NewghReleaseDownloader returns GHRD instance for a github repo
 func NewghReleaseDownloader(RepoName string) (*GHReleaseDownloader, error) {
+	p, err := provider.NewGitHub("")
+	if err != nil {
+		return nil, err
+	}
+	return NewReleaseDownloader(p, RepoName)
+}
+
+// NewReleaseDownloader returns GHRD instance for a repo of given release provider
+func NewReleaseDownloader(p provider.Provider, RepoName string) (*GHReleaseDownloader, error) {
 	var orgName, repoName string
 	if strings.Contains(RepoName, "/") {
 		arr := strings.Split(RepoName, "/")
@@ -59,16 +62,12 @@ func NewghReleaseDownloader(RepoName string) (*GHReleaseDownloader, error) {
 		orgName = Organization
 		repoName = RepoName
 	}
-	httpClient := &http.Client{
-		Timeout: DownloadUpdateTimeout,
-	}
+	httpClient := httpclient.New()
+	httpClient.Timeout = DownloadUpdateTimeout
 	if orgName == "" {
 		return nil, errorutil.NewWithTag("update", "organization name cannot be empty")
 	}
-	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
-		httpClient = oauth2.NewClient(context.Background(), oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}))
-	}
-	ghrd := GHReleaseDownloader{client: github.NewClient(httpClient), repoName: repoName, assetName: repoName, httpClient: httpClient, organization: orgName}
+	ghrd := GHReleaseDownloader{provider: p, repoName: repoName, assetName: repoName, httpClient: httpClient, organization: orgName}
 
 	err := ghrd.getLatestRelease()
 	return &ghrd, err
@@ -81,29 +80,12 @@ func (d *GHReleaseDownloader) SetToolName(toolName string) {
 	}
 }
 
-// DownloadTool downloads tool and returns bin data
-func (d *GHReleaseDownloader) DownloadTool() (*bytes.Buffer, error) {
+// DownloadTool downloads the tool asset to a temporary file, caller must close it
+func (d *GHReleaseDownloader) DownloadTool() (*Asset, error) {
 	if err := d.getToolAssetID(d.Latest); err != nil {
 		return nil, err
 	}
-	resp, err := d.downloadAssetwithID(int64(d.AssetID))
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if !HideProgressBar {
-		bar := pb.New64(resp.ContentLength).SetMaxWidth(100)
-		bar.Start()
-		resp.Body = bar.NewProxyReader(resp.Body)
-		defer bar.Finish()
-	}
-
-	bin, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, errorutil.NewWithErr(err).Msgf("failed to read response body")
-	}
-	return bytes.NewBuffer(bin), nil
+	return d.downloadAsset(d.fullAssetName, !HideProgressBar)
 }
 
 // GetReleaseChecksums tries to download tool checksum if release contains any in map[asset_name]checksum_data format
@@ -111,30 +93,29 @@ func (d *GHReleaseDownloader) GetReleaseChecksums() (map[string]string, error) {
 	builder := &strings.Builder{}
 	builder.WriteString(d.assetName)
 	builder.WriteString("_")
-	builder.WriteString(strings.TrimPrefix(d.Latest.GetTagName(), "v"))
+	builder.WriteString(strings.TrimPrefix(d.Latest.Tag, "v"))
 	builder.WriteString("_")
 	builder.WriteString("checksums.txt")
 	checksumFileName := builder.String()
 
-	checksumFileAssetID := 0
-	for _, v := range d.Latest.Assets {
-		if v.GetName() == checksumFileName {
-			checksumFileAssetID = int(v.GetID())
-		}
-	}
-	if checksumFileAssetID == 0 {
+	asset, ok := d.Latest.GetAsset(checksumFileName)
+	if !ok {
 		return nil, errorutil.NewWithTag("update", "checksum file not in release assets")
 	}
-
-	resp, err := d.downloadAssetwithID(int64(checksumFileAssetID))
+	body, err := d.provider.OpenAsset(context.Background(), d.organization, d.repoName, asset)
 	if err != nil {
 		return nil, errorutil.NewWithErr(err).Msgf("failed to download checksum file")
 	}
-	defer resp.Body.Close()
-	bin, err := io.ReadAll(resp.Body)
+	defer body.Close()
+	bin, err := io.ReadAll(body)
 	if err != nil {
 		return nil, errorutil.NewWithErr(err).Msgf("failed to read checksum file")
 	}
+	return ParseChecksums(bin)
+}
+
+// ParseChecksums parses a checksums file in `<sha256>  <asset_name>` format into map[asset_name]checksum
+func ParseChecksums(bin []byte) (map[string]string, error) {
 	data := strings.TrimSpace(string(bin))
 	if data == "" {
 		return nil, errorutil.NewWithTag("checksum", "something went wrong checksum file is emtpy")
@@ -150,22 +131,26 @@ func (d *GHReleaseDownloader) GetReleaseChecksums() (map[string]string, error) {
 	return m, nil
 }
 
-// GetExecutableFromAsset downloads , validates checksum and only returns tool Binary
-func (d *GHReleaseDownloader) GetExecutableFromAsset() ([]byte, error) {
-	var bin []byte
+// GetExecutableFromAsset downloads , validates checksum and only returns tool Binary in a temporary file, caller must close it
+func (d *GHReleaseDownloader) GetExecutableFromAsset() (*Asset, error) {
+	var bin *Asset
 	var err error
 	getToolCallback := func(path string, fileInfo fs.FileInfo, data io.Reader) error {
 		if !strings.EqualFold(strings.TrimSuffix(fileInfo.Name(), ExtIfFound), d.assetName) {
 			return nil
 		}
-		bin, err = io.ReadAll(data)
+		if bin != nil {
+			_ = bin.Close()
+		}
+		bin, err = DownloadToFile(data)
 		return err
 	}
 
-	buff, err := d.DownloadTool()
+	asset, err := d.DownloadTool()
 	if err != nil {
 		return nil, err
 	}
+	defer asset.Close()
 
 	var expectedChecksum string
 	checksums, err := d.GetReleaseChecksums()
@@ -174,8 +159,7 @@ func (d *GHReleaseDownloader) GetExecutableFromAsset() ([]byte, error) {
 	}
 	// verify integrity using checksum
 	if expectedChecksum != "" {
-		gotChecksumbytes := sha256.Sum256(buff.Bytes())
-		gotchecksum := hex.EncodeToString(gotChecksumbytes[:])
+		gotchecksum := asset.SHA256
 		if expectedChecksum != gotchecksum {
 			return nil, errorutil.NewWithTag("checksum", "asset file corrupted: checksum mismatch expected %v but got %v", expectedChecksum, gotchecksum)
 		} else {
@@ -183,44 +167,29 @@ func (d *GHReleaseDownloader) GetExecutableFromAsset() ([]byte, error) {
 		}
 	}
 
-	_ = UnpackAssetWithCallback(d.Format, bytes.NewReader(buff.Bytes()), getToolCallback)
-	return bin, errorutil.WrapfWithNil(err, "executable not found in archive") // Note: WrapfWithNil wraps msg if err != nil
-}
-
-// DownloadAssetWithName downloads asset with given name
-func (d *GHReleaseDownloader) DownloadAssetWithName(assetname string, showProgressBar bool) (*bytes.Buffer, error) {
-	assetID := 0
-	for _, v := range d.Latest.Assets {
-		if v.GetName() == assetname {
-			assetID = int(v.GetID())
+	if unpackErr := UnpackAssetWithCallback(d.Format, asset, asset.Size, getToolCallback); unpackErr != nil {
+		if bin != nil {
+			_ = bin.Close()
 		}
+		return nil, errorutil.NewWithErr(unpackErr).Msgf("failed to unpack %v", d.fullAssetName)
 	}
-	if assetID == 0 {
-		return nil, errorutil.New("release asset %v not found", assetname)
-	}
-	resp, err := d.downloadAssetwithID(int64(assetID))
-	if err != nil {
-		return nil, errorutil.NewWithErr(err).Msgf("failed to download asset %v", assetname)
-	}
-	defer resp.Body.Close()
-
-	if showProgressBar {
-		bar := pb.New64(resp.ContentLength).SetMaxWidth(100)
-		bar.Start()
-		resp.Body = bar.NewProxyReader(resp.Body)
-		defer bar.Finish()
+	if err == nil && bin == nil {
+		err = errorutil.New("%v not found", d.assetName)
 	}
+	return bin, errorutil.WrapfWithNil(err, "executable not found in archive") // Note: WrapfWithNil wraps msg if err != nil
+}
 
-	bin, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, errorutil.NewWithErr(err).Msgf("failed to read resp body")
-	}
-	return bytes.NewBuffer(bin), nil
+// DownloadAssetWithName downloads asset with given name to a temporary file, caller must close it
+func (d *GHReleaseDownloader) DownloadAssetWithName(assetname string, showProgressBar bool) (*Asset, error) {
+	return d.downloadAsset(assetname, showProgressBar)
 }
 
 // DownloadSourceWithCallback downloads source code of latest release and calls callback for each file in archive
 func (d *GHReleaseDownloader) DownloadSourceWithCallback(showProgressBar bool, callback AssetFileCallback) error {
-	downloadURL := d.Latest.GetZipballURL()
+	downloadURL := d.Latest.SourceURL
+	if downloadURL == "" {
+		return errorutil.NewWithTag("update", "%v releases have no source archive", d.provider.Name())
+	}
 
 	resp, err := d.httpClient.Get(downloadURL)
 	if err != nil {
@@ -234,37 +203,30 @@ func (d *GHReleaseDownloader) DownloadSourceWithCallback(showProgressBar bool, c
 		defer bar.Finish()
 	}
 
-	bin, err := io.ReadAll(resp.Body)
+	asset, err := DownloadToFile(resp.Body)
 	if err != nil {
-		return errorutil.NewWithErr(err).Msgf("failed to read resp body")
+		return err
 	}
-	return UnpackAssetWithCallback(Zip, bytes.NewReader(bin), callback)
+	defer asset.Close()
+	return UnpackAssetWithCallback(Zip, asset, asset.Size, callback)
 }
 
 // getLatestRelease returns latest release of error
 func (d *GHReleaseDownloader) getLatestRelease() error {
-	release, resp, err := d.client.Repositories.GetLatestRelease(context.Background(), d.organization, d.repoName)
+	release, err := d.provider.LatestRelease(context.Background(), d.organization, d.repoName)
 	if err != nil {
-		errx := errorutil.NewWithErr(err)
-		if resp != nil && resp.StatusCode == http.StatusNotFound {
-			errx = errx.Msgf("repo %v/%v not found got %v", d.organization, d.repoName)
-		} else if _, ok := err.(*github.RateLimitError); ok {
-			errx = errx.Msgf("hit github ratelimit while downloading latest release")
-		} else if resp != nil && (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusUnauthorized) {
-			errx = errx.Msgf("gh auth failed try unsetting GITHUB_TOKEN env variable")
-		}
-		return errx
+		return errorutil.NewWithErr(err).Msgf("failed to fetch latest release of %v/%v from %v", d.organization, d.repoName, d.provider.Name())
 	}
 	d.Latest = release
 	return nil
 }
 
 // getToolAssetID tries to find assetId of tool required for this platform
-func (d *GHReleaseDownloader) getToolAssetID(latest *github.RepositoryRelease) error {
+func (d *GHReleaseDownloader) getToolAssetID(latest *provider.Release) error {
 	builder := &strings.Builder{}
 	builder.WriteString(d.assetName)
 	builder.WriteString("_")
-	builder.WriteString(strings.TrimPrefix(latest.GetTagName(), "v"))
+	builder.WriteString(strings.TrimPrefix(latest.Tag, "v"))
 	builder.WriteString("_")
 	if strings.EqualFold(runtime.GOOS, "darwin") {
 		builder.WriteString("macOS")
@@ -276,19 +238,11 @@ func (d *GHReleaseDownloader) getToolAssetID(latest *github.RepositoryRelease) e
 
 loop:
 	for _, v := range latest.Assets {
-		asset := v.GetName()
-		switch {
-		case strings.Contains(asset, Zip.FileExtension()):
-			if strings.EqualFold(asset, builder.String()+Zip.FileExtension()) {
-				d.AssetID = int(v.GetID())
-				d.Format = Zip
-				d.fullAssetName = asset
-				break loop
-			}
-		case strings.Contains(asset, Tar.FileExtension()):
-			if strings.EqualFold(asset, builder.String()+Tar.FileExtension()) {
-				d.AssetID = int(v.GetID())
-				d.Format = Tar
+		asset := v.Name
+		for format := range archiveFormats {
+			if strings.EqualFold(asset, builder.String()+format.FileExtension()) {
+				d.AssetID = int(v.ID)
+				d.Format = format
 				d.fullAssetName = asset
 				break loop
 			}
@@ -296,71 +250,43 @@ loop:
 	}
 	builder.Reset()
 
-	// handle if id is zero (no asset found)
-	if d.AssetID == 0 {
+	if d.fullAssetName == "" {
 		return ErrNoAssetFound.Msgf(runtime.GOOS, runtime.GOARCH)
 	}
 	return nil
 }
 
-// downloadAssetwithID
-func (d *GHReleaseDownloader) downloadAssetwithID(id int64) (*http.Response, error) {
-	_, rdurl, err := d.client.Repositories.DownloadReleaseAsset(context.Background(), d.organization, d.repoName, id, nil)
-	if err != nil {
-		return nil, err
+// downloadAsset downloads the release asset with given name to a temporary file
+func (d *GHReleaseDownloader) downloadAsset(assetName string, showProgressBar bool) (*Asset, error) {
+	asset, ok := d.Latest.GetAsset(assetName)
+	if !ok {
+		return nil, errorutil.New("release asset %v not found", assetName)
 	}
-	resp, err := d.httpClient.Get(rdurl)
+	body, err := d.provider.OpenAsset(context.Background(), d.organization, d.repoName, asset)
 	if err != nil {
-		return nil, errorutil.NewWithErr(err).Msgf("failed to download release asset")
-	}
-	if resp.StatusCode != http.StatusOK {
-		return nil, errorutil.New("something went wrong got %v while downloading asset, expected status 200", resp.StatusCode)
+		return nil, errorutil.NewWithErr(err).Msgf("failed to download asset %v", assetName)
 	}
-	if resp.Body == nil {
-		return nil, errorutil.New("something went wrong got response without body")
+	defer body.Close()
+
+	var data io.Reader = body
+	if showProgressBar {
+		bar := pb.New64(asset.Size).SetMaxWidth(100)
+		bar.Start()
+		data = bar.NewProxyReader(body)
+		defer bar.Finish()
 	}
-	return resp, nil
+
+	return DownloadToFile(data)
 }
 
-// UnpackAssetWithCallback unpacks asset and executes callback function on every file in data
-func UnpackAssetWithCallback(format AssetFormat, data *bytes.Reader, callback AssetFileCallback) error {
-	if format != Zip && format != Tar {
-		return errorutil.NewWithTag("unpack", "github asset format not supported. only zip and tar are supported")
-	}
-	if format == Zip {
-		zipReader, err := zip.NewReader(data, data.Size())
-		if err != nil {
-			return err
-		}
-		for _, f := range zipReader.File {
-			data, err := f.Open()
-			if err != nil {
-				return err
-			}
-			if err := callback(f.Name, f.FileInfo(), data); err != nil {
-				return err
-			}
-			_ = data.Close()
-		}
-	} else if format == Tar {
-		gzipReader, err := gzip.NewReader(data)
-		if err != nil {
-			return err
-		}
-		tarReader := tar.NewReader(gzipReader)
-		// iterate through the files in the archive
-		for {
-			header, err := tarReader.Next()
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				return err
-			}
-			if err := callback(header.Name, header.FileInfo(), tarReader); err != nil {
-				return err
-			}
-		}
-	}
-	return nil
+// UnpackAssetWithCallback unpacks asset of given size and executes callback function on every regular file in data,
+// archives with unsafe paths, links or extracting to too much data are rejected with an extract.EntryError
+func UnpackAssetWithCallback(format AssetFormat, data io.ReaderAt, size int64, callback AssetFileCallback) error {
+	archiveFormat, ok := archiveFormats[format]
+	if !ok {
+		return errorutil.NewWithTag("unpack", "github asset format not supported. only zip, tar.gz, tar.xz, tar.bz2 and tar.zst are supported")
+	}
+	return extract.Walk(archiveFormat, data, size, func(entry extract.Entry, data io.Reader) error {
+		return callback(entry.Name, entry.Info, data)
+	})
 }
@@ -2,9 +2,11 @@ package update
 
 import (
 	"fmt"
-	"strings"
 
 	"github.com/Masterminds/semver/v3"
+	"github.com/chainreactors/crtm/pkg/extract"
+	"github.com/chainreactors/crtm/pkg/provider"
+	"github.com/chainreactors/crtm/pkg/version"
 	"github.com/logrusorgru/aurora"
 )
 
@@ -13,28 +15,47 @@ type AssetFormat uint
 const (
 	Zip AssetFormat = iota
 	Tar
+	TarXz
+	TarBz2
+	TarZst
 	Unknown
 )
 
+// archiveFormats are the formats of the extractor reading the asset formats
+var archiveFormats = map[AssetFormat]extract.Format{
+	Zip:    extract.Zip,
+	Tar:    extract.TarGz,
+	TarXz:  extract.TarXz,
+	TarBz2: extract.TarBz2,
+	TarZst: extract.TarZst,
+}
+
 // FileExtension of this asset format
 func (a AssetFormat) FileExtension() string {
-	if a == Zip {
+	switch a {
+	case Zip:
 		return ".zip"
-	} else if a == Tar {
+	case Tar:
 		return ".tar.gz"
+	case TarXz:
+		return ".tar.xz"
+	case TarBz2:
+		return ".tar.bz2"
+	case TarZst:
+		return ".tar.zst"
 	}
 	return ""
 }
 
 func IdentifyAssetFormat(assetName string) AssetFormat {
-	switch {
-	case strings.HasSuffix(assetName, Zip.FileExtension()):
-		return Zip
-	case strings.HasSuffix(assetName, Tar.FileExtension()):
-		return Tar
-	default:
-		return Unknown
+	if format, ok := extract.FormatFromName(assetName); ok {
+		for assetFormat, archiveFormat := range archiveFormats {
+			if archiveFormat == format {
+				return assetFormat
+			}
+		}
 	}
+	return Unknown
 }
 
 // Tool
@@ -50,7 +71,7 @@ var Aurora aurora.Aurora = aurora.NewAurora(true)
 
 // GetVersionDescription returns tags like (latest) or (outdated) or (dev)
 func GetVersionDescription(current string, latest string) string {
-	if strings.HasSuffix(current, "-dev") {
+	if isDevRelease(current) {
 		if IsDevReleaseOutdated(current, latest) {
 			return fmt.Sprintf("(%v)", Aurora.BrightRed("outdated"))
 		} else {
@@ -66,7 +87,7 @@ func GetVersionDescription(current string, latest string) string {
 
 // IsOutdated returns true if current version is outdated
 func IsOutdated(current, latest string) bool {
-	if strings.HasSuffix(current, "-dev") {
+	if isDevRelease(current) {
 		return IsDevReleaseOutdated(current, latest)
 	}
 	currentVer, _ := semver.NewVersion(current)
@@ -78,24 +99,22 @@ func IsOutdated(current, latest string) bool {
 	return latestVer.GreaterThan(currentVer)
 }
 
-// IsDevReleaseOutdated returns true if installed tool (dev version) is outdated
-// ex: if installed tools is v2.9.1-dev and latest release is v2.9.1 then it is outdated
-// since v2.9.1-dev is released and merged into main/master branch
+// IsDevReleaseOutdated returns true if installed tool (dev version) is outdated, dev versions follow the
+// rules of the dev release channel (a dev, nightly or snapshot prerelease)
+// ex: if installed tools is v2.9.1-dev or v2.9.1-nightly.20240101 and latest release is v2.9.1 then it is
+// outdated since v2.9.1-dev is released and merged into main/master branch, a newer dev build also outdates it
 func IsDevReleaseOutdated(current string, latest string) bool {
-	// remove -dev suffix
-	current = strings.TrimSuffix(current, "-dev")
 	currentVer, _ := semver.NewVersion(current)
 	latestVer, _ := semver.NewVersion(latest)
 	if currentVer == nil || latestVer == nil {
-		if current == latest {
-			return true
-		} else {
-			// can't compare, so consider it latest
-			return false
-		}
-	}
-	if latestVer.GreaterThan(currentVer) || latestVer.Equal(currentVer) {
-		return true
+		// can't compare, so consider it latest
+		return false
 	}
-	return false
+	released, _ := currentVer.SetPrerelease("")
+	return !latestVer.LessThan(&released) || latestVer.GreaterThan(currentVer)
+}
+
+// isDevRelease returns true if version belongs to the dev release channel
+func isDevRelease(current string) bool {
+	return version.ReleaseChannel(&provider.Release{Tag: current}) == version.Dev
 }
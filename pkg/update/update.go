@@ -1,11 +1,11 @@
 package update
 
 import (
-	"bytes"
 	"context"
-	"crypto/tls"
 	"fmt"
-	"github.com/chainreactors/crtm/pkg/utils"
+	"github.com/chainreactors/crtm/pkg/httpclient"
+	"github.com/chainreactors/crtm/pkg/provider"
+	"github.com/chainreactors/crtm/pkg/types"
 	"net/http"
 	"net/url"
 	"os"
@@ -19,9 +19,8 @@ import (
 	"github.com/projectdiscovery/gologger"
 )
 
-const (
-	Organization = "chainreactors"
-)
+// Organization owning the repos of crtm and tools given without an owner
+const Organization = types.Organization
 
 var (
 	// By default when tool is updated release notes of latest version are printed
@@ -51,9 +50,9 @@ func GetUpdateToolFromRepoCallback(toolName, version, repoName string) func() {
 			gologger.Fatal().Label("updater").Msgf("failed to download latest release got %v", err)
 		}
 		gh.SetToolName(toolName)
-		latestVersion, err := semver.NewVersion(gh.Latest.GetTagName())
+		latestVersion, err := semver.NewVersion(gh.Latest.Tag)
 		if err != nil {
-			gologger.Fatal().Label("updater").Msgf("failed to parse semversion from tagname `%v` got %v", gh.Latest.GetTagName(), err)
+			gologger.Fatal().Label("updater").Msgf("failed to parse semversion from tagname `%v` got %v", gh.Latest.Tag, err)
 		}
 		currentVersion, err := semver.NewVersion(version)
 		if err != nil {
@@ -75,7 +74,9 @@ func GetUpdateToolFromRepoCallback(toolName, version, repoName string) func() {
 			gologger.Fatal().Label("updater").Msgf("executable %v not found in release asset `%v` got: %v", toolName, gh.AssetID, err)
 		}
 
-		if err = selfupdate.Apply(bytes.NewBuffer(bin), updateOpts); err != nil {
+		err = selfupdate.Apply(bin, updateOpts)
+		_ = bin.Close()
+		if err != nil {
 			gologger.Error().Msgf("update of %v %v -> %v failed, rolling back update", toolName, currentVersion.String(), latestVersion.String())
 			if err := selfupdate.RollbackError(err); err != nil {
 				gologger.Fatal().Label("updater").Msgf("rollback of update of %v failed got %v,pls reinstall %v", toolName, err, toolName)
@@ -87,7 +88,7 @@ func GetUpdateToolFromRepoCallback(toolName, version, repoName string) func() {
 		gologger.Info().Msgf("%v sucessfully updated %v -> %v (latest)", toolName, currentVersion.String(), latestVersion.String())
 
 		if !HideReleaseNotes {
-			output := gh.Latest.GetBody()
+			output := gh.Latest.Body
 			// adjust colors for both dark / light terminal themes
 			r, err := glamour.NewTermRenderer(glamour.WithAutoStyle())
 			if err != nil {
@@ -109,18 +110,20 @@ func GetUpdateToolFromRepoCallback(toolName, version, repoName string) func() {
 // if repoName is empty then tool name is considered as repoName
 func GetToolVersionCallback(toolName, version string) func() (string, error) {
 	return func() (string, error) {
-		client := utils.GithubClient()
-
-		release, _, err := client.Repositories.GetLatestRelease(context.Background(), Organization, toolName)
+		p, err := provider.NewGitHub("")
 		if err != nil {
-			return "", fmt.Errorf("failed to get latest release from GitHub: %w", err)
+			return "", err
+		}
+		release, err := p.LatestRelease(context.Background(), Organization, toolName)
+		if err != nil {
+			return "", fmt.Errorf("failed to get latest release from %s: %w", p.Name(), err)
 		}
 
-		if release.GetTagName() == "" {
+		if release.Tag == "" {
 			return "", fmt.Errorf("something went wrong, expected version string but got empty string")
 		}
 
-		return release.GetTagName(), nil
+		return release.Tag, nil
 	}
 }
 
@@ -149,11 +152,6 @@ func buildMachineId() string {
 //}
 
 func init() {
-	DefaultHttpClient = &http.Client{
-		Timeout: VersionCheckTimeout,
-		Transport: &http.Transport{
-			Proxy:           http.ProxyFromEnvironment,
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-	}
+	DefaultHttpClient = httpclient.New()
+	DefaultHttpClient.Timeout = VersionCheckTimeout
 }
@@ -28,6 +28,31 @@ func TestGetVersionDescription(t *testing.T) {
 			latest:  "v2.9.0",
 			want:    "(development)",
 		},
+		{
+			current: "v2.9.1-nightly.20240101",
+			latest:  "v2.9.1",
+			want:    "(outdated)",
+		},
+		{
+			current: "v2.9.1-dev.1",
+			latest:  "v2.9.1-dev.2",
+			want:    "(outdated)",
+		},
+		{
+			current: "v2.9.1-snapshot",
+			latest:  "v2.9.0",
+			want:    "(development)",
+		},
+		{
+			current: "v2.9.1-rc.1",
+			latest:  "v2.9.1",
+			want:    "(outdated)",
+		},
+		{
+			current: "v2.9.1-rc.1",
+			latest:  "v2.9.0",
+			want:    "(latest)",
+		},
 		{
 			current: "v2.9.1",
 			latest:  "v2.9.1",
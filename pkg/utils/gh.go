@@ -1,19 +1,18 @@
 package utils
 
 import (
-	"context"
-	"net/http"
-	"os"
-
+	"github.com/chainreactors/crtm/pkg/provider"
+	"github.com/chainreactors/crtm/pkg/types"
 	"github.com/google/go-github/github"
-	"golang.org/x/oauth2"
 )
 
 func GithubClient() *github.Client {
-	var httpclient *http.Client
-	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
-		httpclient = oauth2.NewClient(context.Background(), oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}))
-	}
-	githubClient := github.NewClient(httpclient)
+	// github.com client creation never fails, only enterprise urls are parsed
+	githubClient, _ := provider.NewGithubClient("")
 	return githubClient
 }
+
+// GetProvider returns the release provider of given tool
+func GetProvider(tool types.Tool) (provider.Provider, error) {
+	return provider.New(tool.Provider, tool.ProviderURL)
+}
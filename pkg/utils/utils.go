@@ -2,35 +2,33 @@ package utils
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/chainreactors/crtm/pkg/path"
+	"github.com/chainreactors/crtm/pkg/provider"
+	"github.com/chainreactors/crtm/pkg/registry"
+	"github.com/chainreactors/crtm/pkg/state"
+	"github.com/chainreactors/crtm/pkg/store"
 	"github.com/chainreactors/crtm/pkg/types"
 	"github.com/chainreactors/crtm/pkg/version"
 	"github.com/logrusorgru/aurora/v4"
 )
 
+// Registry is the list of tools known to crtm, it can be replaced with one loaded from override files
+var Registry = registry.Default()
+
 var (
-	CRTMRepo       = "crtm"
-	GOGORepo       = "gogo"
-	SprayRepo      = "spray"
-	ZombieRepo     = "zombie"
-	IoMRepo        = "malice-network"
-	UrlFounderRepo = "urlfounder"
-	CDNCheckRepo   = "cdncheck"
-
-	Tools = map[string]string{
-		//"crtm":       CRTMRepo,
-		"gogo":           GOGORepo,
-		"spray":          SprayRepo,
-		"zombie":         ZombieRepo,
-		"urlfounder":     UrlFounderRepo,
-		"iom":            IoMRepo,
-		"malice_network": IoMRepo,
-		//"cdncheck_cn": CDNCheckRepo,
-	}
+	// Constraints restricts the releases selected for a tool to a semver range, keyed by tool name
+	Constraints = map[string]string{}
+	// Channel is the release channel followed by tools without channel in Channels
+	Channel = version.Stable
+	// Channels is the release channel followed by a tool, keyed by tool name
+	Channels = map[string]version.Channel{}
 )
 
 func getEnv(key, defaultValue string) string {
@@ -44,47 +42,153 @@ func getEnv(key, defaultValue string) string {
 // configure aurora for logging
 var au = aurora.New(aurora.WithColors(true))
 
+// FetchToolList returns the latest release of registry tools. A tool failing to be fetched
+// doesn't stop the others, the tools fetched are returned with the errors joined.
 func FetchToolList() ([]types.Tool, error) {
-	tools := make([]types.Tool, 0)
-	for name, repo := range Tools {
-		tool, err := fetchToolFromGitHub(name, repo)
+	tools := make([]types.Tool, 0, len(Registry.Tools))
+	var errs []error
+	for _, entry := range Registry.Tools {
+		tool, err := fetchTool(entry)
 		if err != nil {
-			return nil, err
+			errs = append(errs, fmt.Errorf("%s: %w", entry.Name, err))
+			continue
 		}
 		tools = append(tools, tool)
 	}
-	return tools, nil
+	return tools, errors.Join(errs...)
 }
 
-func fetchToolFromGitHub(toolName, repo string) (types.Tool, error) {
-	ctx := context.Background()
-	client := GithubClient()
-	release, _, err := client.Repositories.GetLatestRelease(ctx, types.Organization, repo)
+func fetchTool(entry registry.Entry) (types.Tool, error) {
+	tool := entry.Tool()
+	p, err := GetProvider(tool)
+	if err != nil {
+		return types.Tool{}, err
+	}
+	tool.Channel = string(ToolChannel(tool.Name))
+	if tool.Channel != string(version.Stable) {
+		// the latest release is the latest stable one, github answers 404 for repos with only prereleases
+		if err := selectRelease(&tool, p, nil, Constraints[tool.Name]); err != nil {
+			return types.Tool{}, err
+		}
+		return tool, nil
+	}
+	release, err := p.LatestRelease(context.Background(), tool.GetOrg(), tool.Repo)
 	if err != nil {
 		return types.Tool{}, err
 	}
+	SetRelease(&tool, release)
+	if constraint, ok := Constraints[tool.Name]; ok {
+		if err := selectRelease(&tool, p, release, constraint); err != nil {
+			return types.Tool{}, err
+		}
+	}
+	return tool, nil
+}
 
-	assets := make(map[string]int64)
-	for _, asset := range release.Assets {
-		assets[asset.GetName()] = asset.GetID()
+// ToolChannel returns the release channel followed by a tool
+func ToolChannel(toolName string) version.Channel {
+	if channel, ok := Channels[toolName]; ok {
+		return channel
 	}
+	return Channel
+}
 
-	tool := types.Tool{
-		Name:        toolName,
-		Repo:        repo,
-		Version:     strings.TrimPrefix(release.GetTagName(), "v"),
-		Assets:      assets,
-		InstallType: "unknown", // You may want to set this appropriately
+// selectRelease sets the newest release of the tool channel satisfying its version constraint,
+// latest is the latest stable release when already fetched. When no release satisfies the constraint,
+// or it is invalid, the newest release is kept and marked as outside the constraint.
+func selectRelease(tool *types.Tool, p provider.Provider, latest *provider.Release, constraint string) error {
+	var c *semver.Constraints
+	valid := true
+	if constraint != "" {
+		tool.Constraint = constraint
+		// invalid constraints are reported when the config is loaded
+		var err error
+		c, err = semver.NewConstraint(constraint)
+		valid = err == nil
+	}
+	channel := version.Channel(tool.Channel)
+	if latest != nil && channel == version.Stable {
+		if v, err := semver.NewVersion(latest.Tag); !valid || (err == nil && (c == nil || c.Check(v))) {
+			tool.LatestVersion = tool.Version
+			tool.OutsideConstraint = !valid
+			return nil
+		}
+	}
+	releases, err := p.ListReleases(context.Background(), tool.GetOrg(), tool.Repo)
+	if err != nil {
+		return err
+	}
+	newest := version.Select(releases, channel, nil)
+	if newest == nil {
+		return fmt.Errorf("%s: no %s release found", tool.Name, channel)
+	}
+	release := version.Select(releases, channel, c)
+	if release == nil || !valid {
+		release = newest
+		tool.OutsideConstraint = true
+	}
+	tool.LatestVersion = strings.TrimPrefix(newest.Tag, "v")
+	SetRelease(tool, release)
+	return nil
+}
+
+// SetRelease sets version and assets of tool from given release
+func SetRelease(tool *types.Tool, release *provider.Release) {
+	tool.Version = strings.TrimPrefix(release.Tag, "v")
+	tool.ReleaseChannel = string(version.ReleaseChannel(release))
+	tool.Assets = make(map[string]int64, len(release.Assets))
+	tool.AssetURLs = make(map[string]string, len(release.Assets))
+	for _, asset := range release.Assets {
+		tool.Assets[asset.Name] = asset.ID
+		tool.AssetURLs[asset.Name] = asset.URL
 	}
-	return tool, nil
 }
 
 func FetchTool(toolName string) (types.Tool, error) {
-	repo, exists := Tools[toolName]
+	entry, exists := Registry.Get(toolName)
 	if !exists {
-		return types.Tool{}, fmt.Errorf("tool %s not found in Tools map", toolName)
+		return types.Tool{}, fmt.Errorf("tool %s not found in registry", toolName)
 	}
-	return fetchToolFromGitHub(toolName, repo)
+	return fetchTool(entry)
+}
+
+// FetchToolVersion returns given tool with the assets of a specific release version
+func FetchToolVersion(toolName, version string) (types.Tool, error) {
+	entry, exists := Registry.Get(toolName)
+	if !exists {
+		return types.Tool{}, fmt.Errorf("tool %s not found in registry", toolName)
+	}
+	tool := entry.Tool()
+	release, err := FetchRelease(tool, version)
+	if err != nil {
+		return types.Tool{}, err
+	}
+	SetRelease(&tool, release)
+	tool.Pinned = true
+	return tool, nil
+}
+
+// FetchRelease returns the release of tool matching version, tags are looked up with and without the v prefix
+func FetchRelease(tool types.Tool, version string) (*provider.Release, error) {
+	p, err := GetProvider(tool)
+	if err != nil {
+		return nil, err
+	}
+	version = strings.TrimPrefix(version, "v")
+	release, err := p.GetRelease(context.Background(), tool.GetOrg(), tool.Repo, "v"+version)
+	if err == nil {
+		return release, nil
+	}
+	if release, errx := p.GetRelease(context.Background(), tool.GetOrg(), tool.Repo, version); errx == nil {
+		return release, nil
+	}
+	return nil, fmt.Errorf("%s: release %s not found: %w", tool.Name, version, err)
+}
+
+// ParseToolVersion splits a name@version argument, version is empty if not given
+func ParseToolVersion(arg string) (string, string) {
+	name, version, _ := strings.Cut(arg, "@")
+	return name, strings.TrimPrefix(version, "v")
 }
 
 func Contains(s []types.Tool, toolName string) (int, bool) {
@@ -92,14 +196,47 @@ func Contains(s []types.Tool, toolName string) (int, bool) {
 		if strings.EqualFold(a.Name, toolName) {
 			return i, true
 		}
+		for _, alias := range a.Aliases {
+			if strings.EqualFold(alias, toolName) {
+				return i, true
+			}
+		}
 	}
 	return -1, false
 }
 
+// GetInstalledVersion returns the version of tool active in basePath. The version of the receipt recorded
+// in the state is used when the executable still matches the installed one, otherwise the executable was
+// replaced outside of crtm and is run with --version
+func GetInstalledVersion(tool types.Tool, basePath string) (string, error) {
+	if active, ok := store.Active(basePath, tool.Name); ok {
+		if s, err := state.Load(); err == nil {
+			if receipt, ok := s.Receipt(tool.Name, active); ok && matchesReceipt(receipt, basePath) {
+				return receipt.Version, nil
+			}
+		}
+	}
+	return version.ExtractInstalledVersion(tool, basePath)
+}
+
+// matchesReceipt returns true if the executable of the tool in basePath is the one recorded in the receipt
+func matchesReceipt(receipt *state.Receipt, basePath string) bool {
+	executablePath, exists := path.GetExecutablePath(basePath, receipt.Tool)
+	if !exists {
+		return false
+	}
+	expected, ok := receipt.Files[filepath.Base(executablePath)]
+	if !ok {
+		return false
+	}
+	sum, err := state.HashFile(executablePath)
+	return err == nil && strings.EqualFold(sum, expected)
+}
+
 func InstalledVersion(tool types.Tool, basePath string, au *aurora.Aurora) string {
 	var msg string
 
-	installedVersion, err := version.ExtractInstalledVersion(tool, basePath)
+	installedVersion, err := GetInstalledVersion(tool, basePath)
 	if err != nil {
 		osAvailable := isOsAvailable(tool)
 		if !osAvailable {
@@ -111,7 +248,7 @@ func InstalledVersion(tool types.Tool, basePath string, au *aurora.Aurora) strin
 
 	if installedVersion != "" {
 		if strings.Contains(tool.Version, installedVersion) {
-			msg = fmt.Sprintf("(%s) (%s)", au.BrightGreen("latest").String(), au.BrightGreen(tool.Version).String())
+			msg = fmt.Sprintf("(%s) (%s)", au.BrightGreen(tool.VersionLabel()).String(), au.BrightGreen(tool.Version).String())
 		} else {
 			msg = fmt.Sprintf("(%s) (%s) ➡ (%s)",
 				au.Red("outdated").String(),
@@ -120,6 +257,15 @@ func InstalledVersion(tool types.Tool, basePath string, au *aurora.Aurora) strin
 		}
 	}
 
+	if tool.ReleaseChannel != "" && tool.ReleaseChannel != string(version.Stable) {
+		msg += fmt.Sprintf(" (%s)", au.Magenta(tool.ReleaseChannel).String())
+	}
+	if newer := tool.NewerOutsideConstraint(); newer != "" {
+		msg += fmt.Sprintf(" (%s available outside %s)", au.BrightYellow(newer).String(), tool.Constraint)
+	}
+	if tool.OutsideConstraint {
+		msg += fmt.Sprintf(" (%s)", au.BrightYellow("no release satisfies "+tool.Constraint).String())
+	}
 	return msg
 }
 
@@ -2,7 +2,13 @@ package utils
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/chainreactors/crtm/pkg/registry"
+	"github.com/chainreactors/crtm/pkg/version"
 )
 
 func TestFetchToolList(t *testing.T) {
@@ -16,3 +22,111 @@ func TestFetchToolList(t *testing.T) {
 	}
 
 }
+
+func TestParseToolVersion(t *testing.T) {
+	tests := []struct {
+		arg     string
+		name    string
+		version string
+	}{
+		{arg: "gogo", name: "gogo"},
+		{arg: "gogo@2.11.0", name: "gogo", version: "2.11.0"},
+		{arg: "spray@v1.1.0", name: "spray", version: "1.1.0"},
+	}
+	for _, test := range tests {
+		name, version := ParseToolVersion(test.arg)
+		if name != test.name || version != test.version {
+			t.Errorf("ParseToolVersion(%v) = %v, %v, want %v, %v", test.arg, name, version, test.name, test.version)
+		}
+	}
+}
+
+func TestFetchToolPrereleaseOnly(t *testing.T) {
+	// a repo with only prereleases has no latest release
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/releases/latest") {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("page") != "1" {
+			_, _ = w.Write([]byte("[]"))
+			return
+		}
+		_, _ = w.Write([]byte(`[{"tag_name": "v1.1.0-beta.1", "prerelease": true}, {"tag_name": "v1.0.0-rc.1", "prerelease": true}]`))
+	}))
+	defer ts.Close()
+	entry := registry.Entry{Name: "gogo", Repo: "gogo", Org: "chainreactors", Provider: "gitea", URL: ts.URL}
+
+	if _, err := fetchTool(entry); err == nil {
+		t.Errorf("fetchTool() on the stable channel succeeded without stable release")
+	}
+	Channels["gogo"] = version.Beta
+	defer delete(Channels, "gogo")
+	tool, err := fetchTool(entry)
+	if err != nil {
+		t.Fatalf("fetchTool() on the beta channel: %v", err)
+	}
+	if tool.Version != "1.1.0-beta.1" || tool.ReleaseChannel != string(version.Beta) {
+		t.Errorf("fetchTool() = %v (%v), want 1.1.0-beta.1 (beta)", tool.Version, tool.ReleaseChannel)
+	}
+}
+
+func TestFetchToolWithoutOrg(t *testing.T) {
+	// repos of an http directory entry without org are at the root of the server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/gogo/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<a href="v1.0.0/">v1.0.0/</a>`))
+	})
+	mux.HandleFunc("/gogo/v1.0.0/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<a href="gogo_linux_amd64">gogo_linux_amd64</a>`))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	entry := registry.Entry{Name: "gogo", Repo: "gogo", Provider: "http", URL: ts.URL}
+
+	tool, err := fetchTool(entry)
+	if err != nil {
+		t.Fatalf("fetchTool() without org: %v", err)
+	}
+	if tool.Version != "1.0.0" || tool.RepoPath() != "gogo" {
+		t.Errorf("fetchTool() = %v (%v), want 1.0.0 (gogo)", tool.Version, tool.RepoPath())
+	}
+}
+
+func TestFetchToolOutsideConstraint(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/releases/latest") {
+			_, _ = w.Write([]byte(`{"tag_name": "v1.1.0"}`))
+			return
+		}
+		if r.URL.Query().Get("page") != "1" {
+			_, _ = w.Write([]byte("[]"))
+			return
+		}
+		_, _ = w.Write([]byte(`[{"tag_name": "v1.1.0"}, {"tag_name": "v1.0.0"}]`))
+	}))
+	defer ts.Close()
+	entry := registry.Entry{Name: "gogo", Repo: "gogo", Org: "chainreactors", Provider: "gitea", URL: ts.URL}
+	defer delete(Constraints, "gogo")
+
+	// the latest release is kept when no release satisfies the constraint or it is invalid
+	for _, constraint := range []string{">=2", "latest"} {
+		Constraints["gogo"] = constraint
+		tool, err := fetchTool(entry)
+		if err != nil {
+			t.Fatalf("fetchTool() with constraint %q: %v", constraint, err)
+		}
+		if tool.Version != "1.1.0" || !tool.OutsideConstraint {
+			t.Errorf("fetchTool() with constraint %q = %v (outside %v), want 1.1.0 (outside true)", constraint, tool.Version, tool.OutsideConstraint)
+		}
+	}
+
+	Constraints["gogo"] = "~1.0"
+	tool, err := fetchTool(entry)
+	if err != nil {
+		t.Fatalf("fetchTool() with constraint ~1.0: %v", err)
+	}
+	if tool.Version != "1.0.0" || tool.OutsideConstraint || tool.NewerOutsideConstraint() != "1.1.0" {
+		t.Errorf("fetchTool() with constraint ~1.0 = %v (newer %v), want 1.0.0 (newer 1.1.0)", tool.Version, tool.NewerOutsideConstraint())
+	}
+}
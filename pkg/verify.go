@@ -0,0 +1,186 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	ospath "github.com/chainreactors/crtm/pkg/path"
+	"github.com/chainreactors/crtm/pkg/signature"
+	"github.com/chainreactors/crtm/pkg/state"
+	"github.com/chainreactors/crtm/pkg/store"
+	"github.com/chainreactors/crtm/pkg/types"
+	"github.com/chainreactors/crtm/pkg/utils"
+)
+
+// FileStatus is the result of checking an installed file
+type FileStatus string
+
+const (
+	// Modified files don't match the sha256 recorded at install or published in the release checksums
+	Modified FileStatus = "modified"
+	// Missing files were recorded at install but don't exist anymore
+	Missing FileStatus = "missing"
+	// Foreign files weren't installed by crtm
+	Foreign FileStatus = "foreign"
+	// Untrusted files are release checksums whose signature doesn't verify against the pinned keys
+	Untrusted FileStatus = "untrusted"
+)
+
+// Issue is a file of an installed version failing verification
+type Issue struct {
+	Version string
+	File    string
+	Status  FileStatus
+	Detail  string
+}
+
+func (i Issue) String() string {
+	if i.Detail == "" {
+		return fmt.Sprintf("%s %s: %s", i.Version, i.File, i.Status)
+	}
+	return fmt.Sprintf("%s %s: %s (%s)", i.Version, i.File, i.Status, i.Detail)
+}
+
+// Verification is the result of verifying the installed versions of a tool
+type Verification struct {
+	Tool     string
+	Versions []string
+	Issues   []Issue
+	// Unchecked are versions whose release checksums couldn't be fetched
+	Unchecked []string
+}
+
+// Verify re-hashes the installed versions of tool and compares them with the install receipts.
+// The recorded asset sha256 is checked against the release checksums file when the release publishes one.
+func Verify(path string, tool types.Tool) (*Verification, error) {
+	s, err := state.Load()
+	if err != nil {
+		return nil, err
+	}
+	versions, err := store.Versions(tool.Name)
+	if err != nil {
+		return nil, err
+	}
+	receipts := s.Versions(tool.Name)
+	for v := range receipts {
+		if !contains(versions, v) {
+			versions = append(versions, v)
+		}
+	}
+	store.SortVersions(versions)
+
+	result := &Verification{Tool: tool.Name, Versions: versions}
+	for _, v := range versions {
+		receipt, ok := receipts[v]
+		if !ok {
+			result.Issues = append(result.Issues, Issue{Version: v, File: store.VersionDir(tool.Name, v), Status: Foreign, Detail: "no install receipt"})
+			continue
+		}
+		issues, err := verifyFiles(tool.Name, receipt)
+		if err != nil {
+			return nil, err
+		}
+		result.Issues = append(result.Issues, issues...)
+		issue, checked := verifyAsset(tool, receipt)
+		if issue != nil {
+			result.Issues = append(result.Issues, *issue)
+		}
+		if !checked {
+			result.Unchecked = append(result.Unchecked, v)
+		}
+	}
+
+	// the executable in path must be the active version installed by crtm
+	if executablePath, exists := ospath.GetExecutablePath(path, tool.Name); exists {
+		active, ok := store.Active(path, tool.Name)
+		activeExecutable, installed := store.Executable(tool.Name, active)
+		switch {
+		case !ok || !installed:
+			result.Issues = append(result.Issues, Issue{Version: active, File: executablePath, Status: Foreign, Detail: "not installed by crtm"})
+		default:
+			expected, err1 := state.HashFile(activeExecutable)
+			actual, err2 := state.HashFile(executablePath)
+			if err1 == nil && err2 == nil && expected != actual {
+				result.Issues = append(result.Issues, Issue{Version: active, File: executablePath, Status: Modified, Detail: "differs from the active version"})
+			}
+		}
+	}
+	return result, nil
+}
+
+// verifyFiles compares the files of an installed version with its receipt
+func verifyFiles(toolName string, receipt *state.Receipt) ([]Issue, error) {
+	versionDir := store.VersionDir(toolName, receipt.Version)
+	files, err := state.HashFiles(versionDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var issues []Issue
+	for _, name := range sortedKeys(receipt.Files) {
+		actual, ok := files[name]
+		switch {
+		case !ok:
+			issues = append(issues, Issue{Version: receipt.Version, File: filepath.Join(versionDir, name), Status: Missing})
+		case !strings.EqualFold(actual, receipt.Files[name]):
+			issues = append(issues, Issue{Version: receipt.Version, File: filepath.Join(versionDir, name), Status: Modified, Detail: "sha256 " + actual + " expected " + receipt.Files[name]})
+		}
+	}
+	for _, name := range sortedKeys(files) {
+		if _, ok := receipt.Files[name]; !ok {
+			issues = append(issues, Issue{Version: receipt.Version, File: filepath.Join(versionDir, name), Status: Foreign})
+		}
+	}
+	return issues, nil
+}
+
+// verifyAsset compares the asset recorded in the receipt with the release checksums,
+// it returns false if the release checksums couldn't be fetched. A checksums file failing
+// its signature check is reported as an issue.
+func verifyAsset(tool types.Tool, receipt *state.Receipt) (*Issue, bool) {
+	if receipt.Asset == "" || receipt.AssetSHA256 == "" {
+		return nil, false
+	}
+	release, err := utils.FetchRelease(tool, receipt.Version)
+	if err != nil {
+		return nil, false
+	}
+	released := tool
+	utils.SetRelease(&released, release)
+	checksums, err := releaseChecksums(released)
+	switch {
+	case errors.Is(err, signature.ErrBadSignature), errors.Is(err, signature.ErrUnsigned):
+		return &Issue{Version: receipt.Version, File: receipt.Asset, Status: Untrusted, Detail: err.Error()}, true
+	case err != nil:
+		return nil, false
+	}
+	expected, ok := checksums[receipt.Asset]
+	if !ok {
+		return nil, false
+	}
+	if !strings.EqualFold(expected, receipt.AssetSHA256) {
+		return &Issue{Version: receipt.Version, File: receipt.Asset, Status: Modified, Detail: "downloaded sha256 " + receipt.AssetSHA256 + " but release checksums has " + expected}, true
+	}
+	return nil, true
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
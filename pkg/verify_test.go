@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"aead.dev/minisign"
+	"github.com/chainreactors/crtm/pkg/signature"
+	"github.com/chainreactors/crtm/pkg/state"
+	"github.com/chainreactors/crtm/pkg/store"
+	"github.com/chainreactors/crtm/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	dir, err := os.MkdirTemp("", "test-verify")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	store.Root = filepath.Join(dir, "versions")
+	state.Path = filepath.Join(dir, "state.json")
+	binPath := filepath.Join(dir, "bin")
+
+	tool := types.Tool{Name: "gogo", Repo: "gogo", Version: "2.11.0"}
+	versionDir := store.VersionDir(tool.Name, tool.Version)
+	require.Nil(t, os.MkdirAll(versionDir, os.ModePerm))
+	require.Nil(t, os.WriteFile(filepath.Join(versionDir, "gogo"), []byte("gogo"), 0755))
+	require.Nil(t, recordReceipt(tool, "", 0, ""))
+	require.Nil(t, store.Activate(binPath, tool.Name, tool.Version))
+
+	result, err := Verify(binPath, tool)
+	require.Nil(t, err)
+	require.Equal(t, []string{"2.11.0"}, result.Versions)
+	require.Empty(t, result.Issues)
+
+	require.Nil(t, os.WriteFile(filepath.Join(versionDir, "gogo"), []byte("tampered"), 0755))
+	require.Nil(t, os.WriteFile(filepath.Join(versionDir, "payload"), []byte("payload"), 0644))
+	result, err = Verify(binPath, tool)
+	require.Nil(t, err)
+	require.Len(t, result.Issues, 2)
+	require.Equal(t, Modified, result.Issues[0].Status)
+	require.Equal(t, Foreign, result.Issues[1].Status)
+
+	require.Nil(t, os.RemoveAll(versionDir))
+	result, err = Verify(binPath, tool)
+	require.Nil(t, err)
+	require.Equal(t, Missing, result.Issues[0].Status)
+}
+
+func TestVerifyUntrustedChecksums(t *testing.T) {
+	dir, err := os.MkdirTemp("", "test-verify")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	store.Root = filepath.Join(dir, "versions")
+	state.Path = filepath.Join(dir, "state.json")
+
+	_, private, err := minisign.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	otherPublic, _, err := minisign.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	checksums := []byte("aaaa  gogo_1.0.0_linux_amd64.tar.gz\n")
+	sig := minisign.Sign(private, checksums)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/"):
+			_, _ = w.Write([]byte(`<a href="gogo_1.0.0_checksums.txt">.</a><a href="gogo_1.0.0_checksums.txt.minisig">.</a>`))
+		case strings.HasSuffix(r.URL.Path, signature.Ext):
+			_, _ = w.Write(sig)
+		default:
+			_, _ = w.Write(checksums)
+		}
+	}))
+	defer ts.Close()
+
+	tool := types.Tool{Name: "gogo", Repo: "gogo", Version: "1.0.0", Provider: "http", ProviderURL: ts.URL}
+	versionDir := store.VersionDir(tool.Name, tool.Version)
+	require.Nil(t, os.MkdirAll(versionDir, os.ModePerm))
+	require.Nil(t, os.WriteFile(filepath.Join(versionDir, "gogo"), []byte("gogo"), 0755))
+	require.Nil(t, recordReceipt(tool, "gogo_1.0.0_linux_amd64.tar.gz", 1, "aaaa"))
+
+	result, err := Verify(filepath.Join(dir, "bin"), tool)
+	require.Nil(t, err)
+	require.Empty(t, result.Issues)
+	require.Empty(t, result.Unchecked)
+
+	// a checksums file signed with another key is reported, not skipped
+	tool.PublicKeys = []string{otherPublic.String()}
+	result, err = Verify(filepath.Join(dir, "bin"), tool)
+	require.Nil(t, err)
+	require.Len(t, result.Issues, 1)
+	require.Equal(t, Untrusted, result.Issues[0].Status)
+	require.Empty(t, result.Unchecked)
+}
@@ -0,0 +1,90 @@
+package version
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/chainreactors/crtm/pkg/provider"
+)
+
+// Channel is a release channel a tool can be installed from
+type Channel string
+
+const (
+	// Stable only contains full releases
+	Stable Channel = "stable"
+	// Beta contains prereleases (alpha, beta, rc) and stable releases
+	Beta Channel = "beta"
+	// Dev contains every release including development builds
+	Dev Channel = "dev"
+)
+
+// Channels are the supported release channels, from the most to the least stable
+var Channels = []Channel{Stable, Beta, Dev}
+
+// ParseChannel returns the channel with given name, stable if name is empty
+func ParseChannel(name string) (Channel, error) {
+	if name == "" {
+		return Stable, nil
+	}
+	for _, channel := range Channels {
+		if strings.EqualFold(string(channel), name) {
+			return channel, nil
+		}
+	}
+	return "", fmt.Errorf("unknown release channel %s (stable, beta or dev)", name)
+}
+
+// Includes returns true if releases of other are installed when following channel c
+func (c Channel) Includes(other Channel) bool {
+	return c.rank() >= other.rank()
+}
+
+func (c Channel) rank() int {
+	for i, channel := range Channels {
+		if channel == c {
+			return i
+		}
+	}
+	return 0
+}
+
+// ReleaseChannel returns the channel a release belongs to, development builds are tagged
+// with a dev, nightly or snapshot prerelease and other prereleases belong to beta
+func ReleaseChannel(release *provider.Release) Channel {
+	tag := strings.ToLower(release.Tag)
+	var prerelease string
+	if v, err := semver.NewVersion(tag); err == nil {
+		prerelease = v.Prerelease()
+	}
+	for _, marker := range []string{"dev", "nightly", "snapshot"} {
+		if strings.Contains(prerelease, marker) {
+			return Dev
+		}
+	}
+	if release.Prerelease || prerelease != "" {
+		return Beta
+	}
+	return Stable
+}
+
+// Select returns the newest release of channel satisfying constraint, constraint is optional.
+// Releases without a semver tag are ignored, nil is returned if no release matches.
+func Select(releases []*provider.Release, channel Channel, constraint *semver.Constraints) *provider.Release {
+	var latest *provider.Release
+	var latestVersion *semver.Version
+	for _, release := range releases {
+		if !channel.Includes(ReleaseChannel(release)) {
+			continue
+		}
+		v, err := semver.NewVersion(release.Tag)
+		if err != nil || (constraint != nil && !constraint.Check(v)) {
+			continue
+		}
+		if latest == nil || v.GreaterThan(latestVersion) {
+			latest, latestVersion = release, v
+		}
+	}
+	return latest
+}
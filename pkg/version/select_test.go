@@ -0,0 +1,53 @@
+package version
+
+import (
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/chainreactors/crtm/pkg/provider"
+	"github.com/stretchr/testify/require"
+)
+
+var releases = []*provider.Release{
+	{Tag: "v2.13.0-dev"},
+	{Tag: "v2.12.0-beta.1", Prerelease: true},
+	{Tag: "v2.11.3"},
+	{Tag: "v2.11.0"},
+	{Tag: "v2.10.0"},
+	{Tag: "nightly", Prerelease: true},
+}
+
+func TestSelectConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		want       string
+	}{
+		{constraint: "~2.11", want: "v2.11.3"},
+		{constraint: ">=2.10 <2.11", want: "v2.10.0"},
+		{constraint: "*", want: "v2.11.3"},
+	}
+	for _, test := range tests {
+		c, err := semver.NewConstraint(test.constraint)
+		require.Nil(t, err)
+		release := Select(releases, Stable, c)
+		require.NotNil(t, release, test.constraint)
+		require.Equal(t, test.want, release.Tag, test.constraint)
+	}
+
+	c, err := semver.NewConstraint(">=3")
+	require.Nil(t, err)
+	require.Nil(t, Select(releases, Stable, c))
+}
+
+func TestSelectChannel(t *testing.T) {
+	require.Equal(t, "v2.11.3", Select(releases, Stable, nil).Tag)
+	require.Equal(t, "v2.12.0-beta.1", Select(releases, Beta, nil).Tag)
+	require.Equal(t, "v2.13.0-dev", Select(releases, Dev, nil).Tag)
+}
+
+func TestReleaseChannel(t *testing.T) {
+	require.Equal(t, Dev, ReleaseChannel(releases[0]))
+	require.Equal(t, Beta, ReleaseChannel(releases[1]))
+	require.Equal(t, Stable, ReleaseChannel(releases[2]))
+	require.Equal(t, Beta, ReleaseChannel(releases[5]))
+}